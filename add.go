@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const addUrl = host + "/add"
+
+// Save a url to Pocket, printing the item it becomes.
+func add(args []string) {
+	if err := checkCredentials(true); err != nil {
+		exitWithHelp(err)
+	}
+
+	if len(args) != 1 {
+		fatal("add takes a single url")
+	}
+	u, err := url.ParseRequestURI(args[0])
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fatal("invalid url, must be an http or https url", "url", args[0])
+	}
+
+	body := map[string]string{
+		"consumer_key": key,
+		"access_token": token,
+		"url":          u.String(),
+	}
+	if opts.Tags != "" {
+		body["tags"] = opts.Tags
+	}
+
+	// Pocket tells us what it made of the url, though it may not have resolved it yet.
+	var resp struct {
+		Item struct {
+			ItemID        string `json:"item_id"`
+			Title         string `json:"title"`
+			ResolvedTitle string `json:"resolved_title"`
+			ResolvedURL   string `json:"resolved_url"`
+		} `json:"item"`
+	}
+	if err := postPocket(addUrl, body, &resp); err != nil {
+		fatal("Failed adding url", "url", u.String(), "error", err)
+	}
+
+	title := firstNonEmpty(resp.Item.ResolvedTitle, resp.Item.Title, resp.Item.ResolvedURL, u.String())
+	fmt.Printf("Added %s: %s\n", resp.Item.ItemID, strings.TrimSpace(title))
+}
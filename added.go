@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parse a time for -added-after or -added-before, either a date like
+// 2024-05-01, a full RFC 3339 time, or how long ago like 7d, 2w, or 12h.
+func parseAddedTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	// Go durations don't have days or weeks, so handle those ourselves.
+	var ago time.Duration
+	if n, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && strings.HasSuffix(s, "d") {
+		ago = time.Duration(n) * 24 * time.Hour
+	} else if n, err := strconv.Atoi(strings.TrimSuffix(s, "w")); err == nil && strings.HasSuffix(s, "w") {
+		ago = time.Duration(n) * 7 * 24 * time.Hour
+	} else if d, err := time.ParseDuration(s); err == nil {
+		ago = d
+	} else {
+		return time.Time{}, fmt.Errorf("invalid time %q, must be a date like 2024-05-01 or how long ago like 7d", s)
+	}
+
+	if ago < 0 {
+		return time.Time{}, fmt.Errorf("invalid time %q, must not be negative", s)
+	}
+	return now.Add(-ago), nil
+}
+
+// Work out the range of times items have to have been added in, from
+// -added-after and -added-before. Either end is zero if it isn't set.
+func addedRange(o options, now time.Time) (after, before time.Time, err error) {
+	if o.AddedAfter != "" {
+		if after, err = parseAddedTime(o.AddedAfter, now); err != nil {
+			return after, before, err
+		}
+	}
+	if o.AddedBefore != "" {
+		if before, err = parseAddedTime(o.AddedBefore, now); err != nil {
+			return after, before, err
+		}
+	}
+	return after, before, nil
+}
+
+// Check whether an item was added in a range, which it always is if the range
+// is empty. Items without a time added are left out of any range.
+func addedBetween(added, after, before time.Time) bool {
+	if after.IsZero() && before.IsZero() {
+		return true
+	}
+	if added.IsZero() {
+		return false
+	}
+	return (after.IsZero() || !added.Before(after)) && (before.IsZero() || added.Before(before))
+}
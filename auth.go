@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+const (
+	oauthRequestUrl   = host + "/oauth/request"
+	oauthAuthorizeUrl = host + "/oauth/authorize"
+
+	// Where users go to authorize our request token.
+	authorizeUrl = "https://getpocket.com/auth/authorize"
+)
+
+// Walk through Pocket's OAuth flow to get an access token, which only
+// needs our consumer key up front.
+func auth() {
+	if err := checkCredentials(false); err != nil {
+		exitWithHelp(err)
+	}
+
+	// Get a request token for the user to authorize.
+	var request struct {
+		Code string `json:"code"`
+	}
+	err := postPocket(oauthRequestUrl, map[string]string{
+		"consumer_key": key,
+		"redirect_uri": baseURL(),
+	}, &request)
+	if err != nil {
+		fatal("Failed getting request token", "error", err)
+	}
+
+	// Send the user off to authorize it, and wait for them to come back.
+	q := url.Values{}
+	q.Set("request_token", request.Code)
+	q.Set("redirect_uri", baseURL())
+	fmt.Printf("Visit this url to authorize access to your Pocket account:\n\n  %s?%s\n\n", authorizeUrl, q.Encode())
+	fmt.Print("Press enter once you've authorized it.")
+	bufio.NewReader(os.Stdin).ReadString('\n')
+
+	// Trade our authorized request token for an access token.
+	var access struct {
+		AccessToken string `json:"access_token"`
+		Username    string `json:"username"`
+	}
+	err = postPocket(oauthAuthorizeUrl, map[string]string{
+		"consumer_key": key,
+		"code":         request.Code,
+	}, &access)
+	if err != nil {
+		fatal("Failed getting access token", "error", err)
+	}
+
+	fmt.Printf("\nAuthorized %s, your access token is:\n\n  %s\n\n", access.Username, access.AccessToken)
+
+	// Save our credentials so we don't need to set them every session, keeping
+	// any other profiles we have.
+	c, err := loadConfig()
+	if err != nil {
+		fatal("Failed reading config file", "error", err)
+	}
+	if opts.Profile != "" {
+		if c.Profiles == nil {
+			c.Profiles = map[string]config{}
+		}
+		c.Profiles[opts.Profile] = config{ConsumerKey: key, AccessToken: access.AccessToken}
+	} else {
+		c.ConsumerKey, c.AccessToken = key, access.AccessToken
+	}
+
+	path, err := saveConfig(c)
+	if err != nil {
+		fatal("Failed saving config file", "error", err)
+	}
+	fmt.Printf("Saved it to %s\n", path)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// How long to give pages to settle after we've dismissed their overlays.
+const cleanDelay = 500 * time.Millisecond
+
+// Ad and tracker domains we block requests to with -clean, along with any of
+// their subdomains.
+var blockedHosts = []string{
+	"adnxs.com",
+	"adsafeprotected.com",
+	"adservice.google.com",
+	"amazon-adsystem.com",
+	"chartbeat.com",
+	"criteo.com",
+	"criteo.net",
+	"doubleclick.net",
+	"facebook.net",
+	"google-analytics.com",
+	"googleadservices.com",
+	"googlesyndication.com",
+	"googletagmanager.com",
+	"googletagservices.com",
+	"hotjar.com",
+	"moatads.com",
+	"openx.net",
+	"outbrain.com",
+	"pubmatic.com",
+	"quantserve.com",
+	"rubiconproject.com",
+	"scorecardresearch.com",
+	"taboola.com",
+}
+
+// Buttons that accept common cookie consent dialogs, which usually makes them go away.
+var consentButtons = []string{
+	"#onetrust-accept-btn-handler",
+	"#truste-consent-button",
+	".fc-cta-consent",
+	".qc-cmp2-summary-buttons button[mode=primary]",
+	"#didomi-notice-agree-button",
+	".cc-allow",
+	".cc-dismiss",
+	"[data-testid=accept-button]",
+}
+
+// Script that accepts any consent dialogs, then hides what's left of the
+// fixed overlays covering pages, like cookie banners and newsletter popups.
+var dismissOverlaysScript = `(() => {
+	for (const selector of ` + jsStrings(consentButtons) + `) {
+		document.querySelectorAll(selector).forEach(el => el.click());
+	}
+
+	const overlay = /cookie|consent|gdpr|newsletter|subscribe|popup|modal|banner/i;
+	document.querySelectorAll('body *').forEach(el => {
+		const style = getComputedStyle(el);
+		if ((style.position === 'fixed' || style.position === 'sticky') && overlay.test(el.id + ' ' + el.className)) {
+			el.style.setProperty('display', 'none', 'important');
+		}
+	});
+	document.documentElement.style.overflow = '';
+	document.body.style.overflow = '';
+	return true;
+})()`
+
+// Check whether a request is to one of our blocked hosts.
+func isBlocked(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	host := u.Hostname()
+	for _, blocked := range blockedHosts {
+		if host == blocked || strings.HasSuffix(host, "."+blocked) {
+			return true
+		}
+	}
+	return false
+}
+
+// Intercept the page's requests with -clean, failing any to ad and tracker
+// domains and letting the rest through.
+func blockTrackers() chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if !opts.Clean {
+			return nil
+		}
+
+		chromedp.ListenTarget(ctx, func(ev interface{}) {
+			paused, ok := ev.(*fetch.EventRequestPaused)
+			if !ok {
+				return
+			}
+
+			// We can't send commands from inside the listener, so answer from a goroutine.
+			go func() {
+				ctx := cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+
+				var err error
+				if isBlocked(paused.Request.URL) {
+					slog.Debug("Blocked request", "url", paused.Request.URL)
+					err = fetch.FailRequest(paused.RequestID, network.ErrorReasonBlockedByClient).Do(ctx)
+				} else {
+					err = fetch.ContinueRequest(paused.RequestID).Do(ctx)
+				}
+				if err != nil && ctx.Err() == nil {
+					slog.Debug("Could not answer intercepted request", "url", paused.Request.URL, "error", err)
+				}
+			}()
+		})
+
+		return fetch.Enable().Do(ctx)
+	})
+}
+
+// Dismiss consent dialogs and other overlays with -clean, giving the page a
+// moment to settle after.
+func dismissOverlays() chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if !opts.Clean {
+			return nil
+		}
+
+		var res interface{}
+		if err := chromedp.Evaluate(dismissOverlaysScript, &res).Do(ctx); err != nil {
+			slog.Debug("Could not dismiss overlays", "error", err)
+		}
+		return chromedp.Sleep(cleanDelay).Do(ctx)
+	})
+}
+
+// Write a list of strings as a JavaScript array.
+func jsStrings(values []string) string {
+	data, _ := json.Marshal(values)
+	return string(data)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// A subcommand, with the flags and arguments it takes and what it does.
+// Commands without any args don't take any arguments after their flags.
+type command struct {
+	name        string
+	args        string
+	description string
+	flags       func(fs *flag.FlagSet)
+	run         func(args []string)
+}
+
+// Our subcommands, in the order we list them in our usage.
+var commands = []command{
+	{
+		name:        "serve",
+		description: "Serve the cached list, images, feed, and a live list of items. This is the default.",
+		flags: func(fs *flag.FlagSet) {
+			pocketFlags(fs)
+			processFlags(fs)
+			serverFlags(fs)
+			fs.StringVar(&opts.CORSOrigin, "cors-origin", opts.CORSOrigin, "origins allowed to make cross-origin requests, comma separated or * for any (default off)")
+			fs.DurationVar(&opts.Refresh, "refresh", opts.Refresh, "how often to refresh the cache in the background, like get does (default never)")
+			fs.StringVar(&opts.RefreshToken, "refresh-token", opts.RefreshToken, "secret to allow refreshing the cache with POST /api/refresh, or set POCKET_REFRESH_TOKEN (default off)")
+			fs.DurationVar(&opts.CacheTTL, "cache-ttl", opts.CacheTTL, "how long to keep live items in memory before fetching them from Pocket again, 0 to always fetch")
+		},
+		run: func([]string) { serve() },
+	},
+	{
+		name:        "get",
+		description: "Refresh the cached list of items, saving images for new ones.",
+		flags: func(fs *flag.FlagSet) {
+			pocketFlags(fs)
+			processFlags(fs)
+			serverFlags(fs)
+			fs.BoolVar(&opts.Since, "since", opts.Since, "only get items that changed since the last run, merging them into the cache")
+			fs.StringVar(&opts.SinceFile, "since-file", opts.SinceFile, "file to keep the state of the last -since run in (default cache/state.json in the output dir)")
+			fs.BoolVar(&opts.DryRun, "dry-run", opts.DryRun, "list what would be saved for each item without launching Chrome or writing any files")
+			fs.StringVar(&opts.Output, "output", opts.Output, "format to also write items as, alongside the json cache: "+strings.Join(validOutputs, ", "))
+		},
+		run: func([]string) { get() },
+	},
+	{
+		name:        "feed",
+		description: "Refresh the list of items, writing it as an RSS feed.",
+		flags: func(fs *flag.FlagSet) {
+			pocketFlags(fs)
+			processFlags(fs)
+			serverFlags(fs)
+		},
+		run: func([]string) { feed() },
+	},
+	{
+		name:        "digest",
+		description: "Write the items added in the last few days as an HTML email body.",
+		flags: func(fs *flag.FlagSet) {
+			pocketFlags(fs)
+			processFlags(fs)
+			serverFlags(fs)
+			fs.IntVar(&opts.DigestDays, "days", opts.DigestDays, "how many days back to include items added in, unless -added-after or -added-before is set")
+		},
+		run: func([]string) { writeDigest() },
+	},
+	{
+		name:        "prune",
+		description: "Delete images of items that are no longer in the list.",
+		flags: func(fs *flag.FlagSet) {
+			pocketFlags(fs)
+			fs.BoolVar(&opts.DryRun, "dry-run", opts.DryRun, "list the images that would be deleted without deleting them")
+		},
+		run: func([]string) { prune() },
+	},
+	{
+		name:        "auth",
+		description: "Get an access token for your Pocket account, and save it to the config file.",
+		flags:       func(fs *flag.FlagSet) {},
+		run:         func([]string) { auth() },
+	},
+	{
+		name:        "add",
+		args:        "<url>",
+		description: "Save a url to Pocket.",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&opts.Tags, "tags", opts.Tags, "comma separated tags to save the url with")
+		},
+		run: add,
+	},
+	{
+		name:        "archive",
+		args:        "<id>...",
+		description: "Archive items in Pocket, marking them as read.",
+		flags:       func(fs *flag.FlagSet) {},
+		run:         archive,
+	},
+	{
+		name:        "favorite",
+		args:        "<id>...",
+		description: "Favorite items in Pocket.",
+		flags:       func(fs *flag.FlagSet) {},
+		run:         favoriteItems("favorite", true),
+	},
+	{
+		name:        "unfavorite",
+		args:        "<id>...",
+		description: "Unfavorite items in Pocket.",
+		flags:       func(fs *flag.FlagSet) {},
+		run:         favoriteItems("unfavorite", false),
+	},
+	{
+		name:        "delete",
+		args:        "<id>...",
+		description: "Delete items from Pocket, along with their images and cached copies.",
+		flags:       func(fs *flag.FlagSet) {},
+		run:         deleteItems,
+	},
+}
+
+// Flags for every command: our credentials, where our cache is, and how much to log.
+func commonFlags(fs *flag.FlagSet) {
+	fs.StringVar(&opts.ConsumerKey, "consumer-key", opts.ConsumerKey, "Pocket consumer key, if not in the config file or POCKET_CONSUMER_KEY")
+	fs.StringVar(&opts.AccessToken, "access-token", opts.AccessToken, "Pocket access token, if not in the config file or POCKET_ACCESS_TOKEN")
+	fs.DurationVar(&opts.Timeout, "timeout", opts.Timeout, "how long to wait for a Pocket request before giving up on it")
+	fs.StringVar(&opts.Profile, "profile", opts.Profile, "profile from the config file to use, for another Pocket account with its own cache and images")
+	fs.StringVar(&opts.OutputDir, "output-dir", opts.OutputDir, "directory to keep the cache and images in")
+	fs.StringVar(&opts.Store, "store", opts.Store, "where to keep cached items: "+strings.Join(validStores, ", "))
+	fs.BoolVar(&opts.LegacyArray, "legacy-array", opts.LegacyArray, "write and serve the cached list as a bare array of items, as before it had a version")
+	fs.StringVar(&opts.LogLevel, "log-level", opts.LogLevel, "least important messages to log: "+strings.Join(validLogLevels, ", "))
+	fs.StringVar(&opts.UserAgent, "user-agent", opts.UserAgent, "user agent to send for screenshots, PDFs, and image and page downloads; -mobile uses a phone's unless this is set")
+	fs.StringVar(&opts.LogFormat, "log-format", opts.LogFormat, "format to log in: "+strings.Join(validLogFormats, ", ")+" (default text on a terminal, json otherwise)")
+}
+
+// Flags for commands that retrieve items from Pocket.
+func pocketFlags(fs *flag.FlagSet) {
+	fs.StringVar(&opts.State, "state", opts.State, "which items to retrieve: "+strings.Join(validStates, ", "))
+	fs.StringVar(&opts.Tag, "tag", opts.Tag, "only retrieve items with this tag, or _untagged_ for items without any")
+	fs.BoolVar(&opts.FavoritesOnly, "favorites-only", opts.FavoritesOnly, "only retrieve favorited items, along with any -state and -tag")
+	fs.StringVar(&opts.Search, "search", opts.Search, "only retrieve items whose title or url matches this keyword (full text needs Pocket Premium)")
+	fs.StringVar(&opts.Detail, "detail", opts.Detail, "how much detail to get about each item: simple leaves out tags and images, "+strings.Join(validDetails, " or "))
+	fs.StringVar(&opts.Sort, "sort", opts.Sort, "order to sort items in: "+strings.Join(validSorts, ", "))
+	fs.IntVar(&opts.MaxAttempts, "max-attempts", opts.MaxAttempts, "how many times to try a Pocket request before giving up")
+	fs.DurationVar(&opts.RetryDelay, "retry-delay", opts.RetryDelay, "how long to wait before retrying a Pocket request, doubling each time")
+}
+
+// Flags for commands that turn Pocket's items into ours, saving their images
+// and screenshots unless -screenshots is false.
+func processFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&opts.Screenshots, "screenshots", opts.Screenshots, "save images and screenshots for items")
+	fs.IntVar(&opts.ImageAttempts, "image-attempts", opts.ImageAttempts, "how many runs to try saving an image for an item on before giving up on it")
+	fs.DurationVar(&opts.ImageRetryDelay, "image-retry-delay", opts.ImageRetryDelay, "how long to wait before retrying an item whose image failed, doubling each time")
+	fs.BoolVar(&opts.Revalidate, "revalidate", opts.Revalidate, "check whether saved remote images have changed at their source, and download them again if they have")
+	fs.BoolVar(&opts.Verbose, "verbose", opts.Verbose, "log how long fetching from Pocket and each item's images take, with a summary at the end")
+	fs.BoolVar(&opts.StripTracking, "strip-tracking", opts.StripTracking, "strip tracking params like utm_source and fbclid from item urls")
+	fs.BoolVar(&opts.SkipUnresolved, "skip-unresolved", opts.SkipUnresolved, "leave out items Pocket hasn't resolved yet, rather than keeping them without images until a later run")
+	fs.BoolVar(&opts.Dedupe, "dedupe", opts.Dedupe, "share images between items saved from the same url, rather than saving them for each")
+	fs.IntVar(&opts.Limit, "limit", opts.Limit, "only process this many items, after sorting them (default all)")
+	fs.StringVar(&opts.AddedAfter, "added-after", opts.AddedAfter, "only process items added at or after this date, like 2024-05-01, or this long ago, like 7d, 2w, or 12h")
+	fs.StringVar(&opts.AddedBefore, "added-before", opts.AddedBefore, "only process items added before this date, like 2024-06-01, or this long ago, like 30d")
+	fs.IntVar(&opts.WordsPerMinute, "wpm", opts.WordsPerMinute, "reading speed in words per minute, for estimating reading time")
+	fs.IntVar(&opts.Workers, "workers", opts.Workers, "how many items to process (and screenshot) at once (default -concurrency)")
+	fs.IntVar(&opts.Concurrency, "concurrency", opts.Concurrency, "most screenshots, PDFs, and image downloads to run at once across all workers; Chrome is memory hungry, so keep this low on small machines")
+	fs.IntVar(&opts.MaxPageLoads, "max-page-loads", opts.MaxPageLoads, "most pages to load in Chrome at once, for screenshots and PDFs (default -concurrency)")
+	fs.DurationVar(&opts.PageDelay, "page-delay", opts.PageDelay, "average time between starting page loads, with random jitter, to go easy on sites (default none)")
+	fs.DurationVar(&opts.ScreenshotTimeout, "screenshot-timeout", opts.ScreenshotTimeout, "how long to wait for a page before giving up on its screenshot")
+	fs.StringVar(&opts.Wait, "wait", opts.Wait, "what to wait for after a page loads before its screenshot: "+strings.Join(validWaits, ", "))
+	fs.DurationVar(&opts.WaitDelay, "wait-delay", opts.WaitDelay, "how much longer to wait before taking a screenshot, for pages that animate in")
+	fs.StringVar(&opts.Format, "format", opts.Format, "image format for screenshots: png, jpeg, or webp")
+	fs.IntVar(&opts.Quality, "quality", opts.Quality, "quality of jpeg and webp screenshots, from 0 to 100; png is lossless and ignores it")
+	fs.BoolVar(&opts.FullPage, "fullpage", opts.FullPage, "capture the full scrolling page instead of just the viewport")
+	fs.StringVar(&opts.Aspect, "aspect", opts.Aspect, "aspect ratio to crop screenshots to from the top of the page, like 16:9 (default the viewport's)")
+	fs.IntVar(&opts.Width, "width", opts.Width, "viewport width for screenshots")
+	fs.IntVar(&opts.Height, "height", opts.Height, "viewport height for screenshots")
+	fs.Float64Var(&opts.Scale, "scale", opts.Scale, "device scale factor for screenshots")
+	fs.BoolVar(&opts.Mobile, "mobile", opts.Mobile, "take screenshots with a phone viewport and user agent")
+	fs.StringVar(&opts.CookieFile, "cookies", opts.CookieFile, "file of cookies to set on pages for screenshots and PDFs, like logins for paywalled sites, as JSON or a Netscape cookies.txt")
+	fs.BoolVar(&opts.PDF, "pdf", opts.PDF, "save a PDF of each item's page in cache/pdf, even without -screenshots")
+	fs.BoolVar(&opts.Clean, "clean", opts.Clean, "block ads and trackers and dismiss cookie banners and popups in screenshots, which is slower")
+	fs.BoolVar(&opts.Dark, "dark", opts.Dark, "take screenshots with pages in dark mode, for sites that support it")
+	fs.Int64Var(&opts.MaxImageSize, "max-image-size", opts.MaxImageSize, "largest remote image to download, in bytes")
+	fs.BoolVar(&opts.EmbedImages, "embed-images", opts.EmbedImages, "embed saved images in items as base64 data urls rather than linking to them, for self-contained exports; makes the JSON much larger")
+	fs.Int64Var(&opts.EmbedMaxSize, "embed-max-size", opts.EmbedMaxSize, "largest image to embed with -embed-images, in bytes; bigger ones are still linked to")
+	fs.DurationVar(&opts.ImageTimeout, "image-timeout", opts.ImageTimeout, "how long to wait for a remote image or page")
+}
+
+// Flags for commands that serve, or link to, our images.
+func serverFlags(fs *flag.FlagSet) {
+	fs.StringVar(&opts.Addr, "addr", opts.Addr, "address to serve on, which is also used for image urls without -public-base-url")
+	fs.StringVar(&opts.PublicBaseURL, "public-base-url", opts.PublicBaseURL, "url the server is reached at from outside, like https://pocket.example.com behind a proxy, for image urls")
+	fs.BoolVar(&opts.RelativeURLs, "relative-urls", opts.RelativeURLs, "give items image urls relative to the server, like /images/123.png, so they work on any host")
+}
+
+// Find a command by its name.
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// Set up a command's flags, with usage that describes the command.
+func (c command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ExitOnError)
+	commonFlags(fs)
+	c.flags(fs)
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s\n\n%s\n\nFlags:\n", strings.TrimSpace("pocket "+c.name+" [flags] "+c.args), c.description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// Print the commands we have, and how to get help with each of them.
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: pocket [command] [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-11s %s\n", c.name, c.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun `pocket <command> -h` to see the flags for a command.\n")
+}
+
+// Work out which command we've been asked to run, and parse its flags. The
+// command comes first, followed by any flags for it, and we serve by default.
+// Anything after the flags is returned as the command's arguments.
+func parseCommand(args []string) (command, []string) {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	} else if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+		usage()
+		os.Exit(0)
+	}
+
+	if name == "help" {
+		usage()
+		os.Exit(0)
+	}
+
+	c, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	fs := c.flagSet()
+	fs.Parse(args)
+	if fs.NArg() > 0 && c.args == "" {
+		fmt.Fprintf(os.Stderr, "Unexpected arguments: %s\n\n", strings.Join(fs.Args(), " "))
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	return c, fs.Args()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Struct for the credentials we keep in our config file between sessions.
+// Profiles have their own credentials, for other Pocket accounts.
+type config struct {
+	ConsumerKey string            `json:"consumer_key"`
+	AccessToken string            `json:"access_token"`
+	Profiles    map[string]config `json:"profiles,omitempty"`
+}
+
+// Get the path to our config file, usually ~/.config/pocket-server/config.json.
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pocket-server", "config.json"), nil
+}
+
+// Load our config file, which is empty if it doesn't exist yet.
+func loadConfig() (config, error) {
+	var c config
+
+	path, err := configPath()
+	if err != nil {
+		return c, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return c, err
+	}
+
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("decoding %s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// Save our config file, readable only by us as it holds our access token.
+func saveConfig(c config) (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return path, ioutil.WriteFile(path, data, 0o600)
+}
+
+// Work out our credentials, preferring the config file, then environment
+// variables, then flags. A -profile that isn't in the config file yet is only
+// allowed when we're adding it, which only needs our consumer key.
+func loadCredentials(addingProfile bool) error {
+	c, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	// A profile's account is only in the config file, though it can share our
+	// consumer key, since that's for the app rather than the account.
+	if opts.Profile != "" {
+		p, ok := c.Profiles[opts.Profile]
+		if !ok && !addingProfile {
+			return fmt.Errorf("no profile %q in the config file, run `pocket auth -profile %s` to add it", opts.Profile, opts.Profile)
+		}
+		key = firstNonEmpty(p.ConsumerKey, c.ConsumerKey, os.Getenv("POCKET_CONSUMER_KEY"), opts.ConsumerKey)
+		token = firstNonEmpty(p.AccessToken, opts.AccessToken)
+		return nil
+	}
+
+	key = firstNonEmpty(c.ConsumerKey, os.Getenv("POCKET_CONSUMER_KEY"), opts.ConsumerKey)
+	token = firstNonEmpty(c.AccessToken, os.Getenv("POCKET_ACCESS_TOKEN"), opts.AccessToken)
+	return nil
+}
+
+// Explain where we look for credentials, for when we can't find them.
+func credentialsHelp() string {
+	path, err := configPath()
+	if err != nil {
+		path = "pocket-server/config.json in your config directory"
+	}
+
+	return fmt.Sprintf("Pocket credentials are read from, in order:\n"+
+		"  1. the config file at %s (written by `pocket auth`)\n"+
+		"  2. the POCKET_CONSUMER_KEY and POCKET_ACCESS_TOKEN environment variables\n"+
+		"  3. the -consumer-key and -access-token flags\n"+
+		"With -profile, its token comes from that profile in the config file, saved by `pocket auth -profile`", path)
+}
+
+// Make sure we have the credentials a command needs before it makes any
+// requests, explaining which are missing and how to get them.
+func checkCredentials(needToken bool) error {
+	var missing []string
+	if key == "" {
+		missing = append(missing, "POCKET_CONSUMER_KEY is not set, create an app at https://getpocket.com/developer/apps/new to get a consumer key")
+	}
+	if needToken && token == "" {
+		missing = append(missing, "POCKET_ACCESS_TOKEN is not set, run `pocket auth` to get an access token")
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("missing Pocket credentials:\n  %s\n%s", strings.Join(missing, "\n  "), credentialsHelp())
+}
+
+// Get the first of a list of strings that isn't empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
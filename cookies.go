@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// A cookie to send with pages we screenshot, like a login for a paywalled
+// site. Its value is a secret, so it never goes in our logs.
+type cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Domain   string `json:"domain"`
+	Path     string `json:"path"`
+	Secure   bool   `json:"secure"`
+	HTTPOnly bool   `json:"httpOnly"`
+
+	// Exports differ on what they call when a cookie expires, in Unix seconds.
+	Expires        float64 `json:"expires"`
+	ExpirationDate float64 `json:"expirationDate"`
+}
+
+// The cookies from our -cookies file, loaded before we take any screenshots.
+var cookies []cookie
+
+// Read cookies from a file, either a JSON array of cookies like browser
+// extensions export, or a Netscape cookies.txt like curl and wget use.
+func loadCookies(filename string) ([]cookie, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		var loaded []cookie
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", filename, err)
+		}
+		return loaded, nil
+	}
+
+	return parseNetscapeCookies(data)
+}
+
+// Parse a Netscape cookies.txt, where each line is a cookie's domain, whether
+// it's for subdomains, its path, whether it's secure, when it expires, its
+// name, and its value, separated by tabs.
+func parseNetscapeCookies(data []byte) ([]cookie, error) {
+	var loaded []cookie
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Http only cookies are commented out with a prefix, but other comments are just comments.
+		httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("line %d of cookies file has %d fields, expected 7", n, len(fields))
+		}
+
+		expires, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d of cookies file has an invalid expiry %q", n, fields[4])
+		}
+
+		loaded = append(loaded, cookie{
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Expires:  expires,
+			Name:     fields[5],
+			Value:    fields[6],
+			HTTPOnly: httpOnly,
+		})
+	}
+	return loaded, scanner.Err()
+}
+
+// Check whether a cookie is for a host, or a domain the host is under.
+func (c cookie) matches(host string) bool {
+	domain := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+	host = strings.ToLower(host)
+	return domain != "" && (host == domain || strings.HasSuffix(host, "."+domain))
+}
+
+// Set any of our cookies that are for a page's host before we navigate to it,
+// so pages we're logged in to render as they would for us.
+func injectCookies(rawURL string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if len(cookies) == 0 {
+			return nil
+		}
+
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil
+		}
+
+		var params []*network.CookieParam
+		for _, c := range cookies {
+			if !c.matches(u.Hostname()) {
+				continue
+			}
+
+			param := &network.CookieParam{
+				Name:     c.Name,
+				Value:    c.Value,
+				Domain:   c.Domain,
+				Path:     c.Path,
+				Secure:   c.Secure,
+				HTTPOnly: c.HTTPOnly,
+			}
+			expires := c.Expires
+			if expires == 0 {
+				expires = c.ExpirationDate
+			}
+			if expires > 0 {
+				t := cdp.TimeSinceEpoch(time.Unix(int64(expires), 0))
+				param.Expires = &t
+			}
+			params = append(params, param)
+		}
+		if len(params) == 0 {
+			return nil
+		}
+
+		slog.Debug("Setting cookies", "host", u.Hostname(), "count", len(params))
+		return network.SetCookies(params).Do(ctx)
+	})
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// Build the url for an item's saved image, which with -embed-images is a data
+// url of the image itself, so the JSON works without us serving it. Images
+// over -embed-max-size are still linked to, to keep the JSON from ballooning.
+func itemImageURL(profile, name, filename string) string {
+	if !opts.EmbedImages {
+		return imageURL(profile, name)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil || info.Size() > opts.EmbedMaxSize {
+		slog.Debug("Not embedding image", "file", filename, "max_bytes", opts.EmbedMaxSize)
+		return imageURL(profile, name)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		slog.Warn("Could not read image to embed", "file", filename, "error", err)
+		return imageURL(profile, name)
+	}
+
+	return "data:" + http.DetectContentType(data) + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+var digestFile = filepath.Join(cacheDir, "digest.html")
+
+var digestTemplate = template.Must(template.ParseFS(templates, "templates/digest.html"))
+
+// What our digest template renders: the items added in a range of time.
+type digest struct {
+	After  time.Time
+	Before time.Time
+	Items  []Item
+}
+
+// Render a digest of items as an email body. Everything is styled inline, and
+// thumbnails link to where we serve them, since email clients won't resolve
+// anything relative or load a stylesheet.
+func buildDigest(items []Item, after, before time.Time) ([]byte, error) {
+	d := digest{After: after, Before: before, Items: make([]Item, len(items))}
+	for i, item := range items {
+		item.Thumbnail = absoluteURL(publicURL(), firstNonEmpty(item.Thumbnail, item.Image))
+		d.Items[i] = item
+	}
+
+	var buf bytes.Buffer
+	if err := digestTemplate.Execute(&buf, d); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Get the items added in the last -days, or between -added-after and
+// -added-before, and write them to the cache as an HTML digest.
+func writeDigest() {
+	if err := checkCredentials(true); err != nil {
+		exitWithHelp(err)
+	}
+
+	// An explicit range wins over -days.
+	if opts.AddedAfter == "" && opts.AddedBefore == "" {
+		opts.AddedAfter = strconv.Itoa(opts.DigestDays) + "d"
+	}
+	after, before, err := addedRange(opts, time.Now())
+	if err != nil {
+		fatal(err.Error())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	items, err := pocketItems(ctx, true)
+	if err != nil {
+		fatal("Failed retrieving items", "error", err)
+	}
+
+	data, err := buildDigest(items, after, before)
+	if err != nil {
+		fatal("Failed rendering digest", "error", err)
+	}
+
+	if err := writeFileAtomic(outputPath(digestFile), data); err != nil {
+		fatal("Failed writing digest file", "error", err)
+	}
+
+	slog.Info("Wrote digest", "count", len(items), "file", outputPath(digestFile))
+}
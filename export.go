@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	htmlFile = filepath.Join(cacheDir, "index.html")
+	csvFile  = filepath.Join(cacheDir, "all.csv")
+	mdFile   = filepath.Join(cacheDir, "all.md")
+)
+
+// Formats we can write our items out as, on top of the JSON cache.
+var validOutputs = []string{"json", "html", "csv", "markdown", "manifest"}
+
+//go:embed templates
+var templates embed.FS
+
+var indexTemplate = template.Must(template.ParseFS(templates, "templates/index.html"))
+
+// Write our items out in the format chosen with -output. The JSON cache is
+// always written, so there's nothing more to do for json.
+func writeOutput(items []Item) error {
+	switch opts.Output {
+	case "html":
+		return writeHTML(items)
+	case "csv":
+		return writeCSV(items)
+	case "markdown":
+		return writeMarkdown(items)
+	case "manifest":
+		return writeManifest(items)
+	}
+	return nil
+}
+
+// Render our items as a browsable page.
+func writeHTML(items []Item) error {
+	var buf bytes.Buffer
+	if err := indexTemplate.Execute(&buf, items); err != nil {
+		return fmt.Errorf("rendering %s: %w", htmlFile, err)
+	}
+	return writeFileAtomic(outputPath(htmlFile), buf.Bytes())
+}
+
+// Write our items as a spreadsheet, one row per item.
+func writeCSV(items []Item) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	w.Write([]string{"id", "title", "url", "excerpt", "type", "word_count", "favorite", "tags"})
+	for _, item := range items {
+		w.Write([]string{
+			strconv.Itoa(item.ID),
+			item.Title,
+			item.URL,
+			item.Excerpt,
+			item.Type,
+			strconv.Itoa(item.WordCount),
+			strconv.FormatBool(item.Favorite),
+			strings.Join(item.Tags, ","),
+		})
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("writing %s: %w", csvFile, err)
+	}
+	return writeFileAtomic(outputPath(csvFile), buf.Bytes())
+}
+
+// Characters that Markdown treats specially wherever they appear.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	"*", `\*`,
+	"_", `\_`,
+	"[", `\[`,
+	"]", `\]`,
+	"<", `\<`,
+	">", `\>`,
+)
+
+// A numbered list marker at the start of a line.
+var markdownNumberedList = regexp.MustCompile(`^(\d+)([.)])`)
+
+// Escape text so it shows up as-is in Markdown, rather than being formatted.
+func escapeMarkdown(s string) string {
+	s = markdownEscaper.Replace(strings.TrimSpace(s))
+
+	// Anything at the start of a line that would make it a heading or list needs escaping too.
+	if s != "" && strings.ContainsAny(s[:1], "#+-") {
+		s = `\` + s
+	}
+	return markdownNumberedList.ReplaceAllString(s, `$1\$2`)
+}
+
+// Write our items as a Markdown list, with each title linking to the item,
+// its tags as inline code, and its excerpt as a blockquote.
+func writeMarkdown(items []Item) error {
+	// Characters that would end a link's url early.
+	urlEscaper := strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29")
+
+	var b strings.Builder
+	for _, item := range items {
+		fmt.Fprintf(&b, "- [%s](%s)", escapeMarkdown(item.Title), urlEscaper.Replace(item.URL))
+		for _, tag := range item.Tags {
+			fmt.Fprintf(&b, " `%s`", strings.ReplaceAll(tag, "`", "'"))
+		}
+		b.WriteString("\n")
+
+		if excerpt := strings.TrimSpace(item.Excerpt); excerpt != "" {
+			for _, line := range strings.Split(excerpt, "\n") {
+				fmt.Fprintf(&b, "  > %s\n", escapeMarkdown(line))
+			}
+		}
+	}
+
+	return writeFileAtomic(outputPath(mdFile), []byte(b.String()))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Where we keep track of items we couldn't save an image for, keyed by their
+// image key, so we can retry them on later runs without retrying forever.
+var failuresFile = filepath.Join(cacheDir, "failures.json")
+
+// How many times we've failed to save an image, and when we last tried.
+type imageFailure struct {
+	Attempts    int       `json:"attempts"`
+	LastAttempt time.Time `json:"last_attempt"`
+}
+
+// Wait longer after each failed attempt, doubling from -image-retry-delay.
+func (f imageFailure) nextAttempt() time.Time {
+	return f.LastAttempt.Add(opts.ImageRetryDelay << (f.Attempts - 1))
+}
+
+// Our failures, read the first time we need them and written back once we've
+// processed our items, if they've changed.
+var failures struct {
+	once    sync.Once
+	mu      sync.Mutex
+	byKey   map[string]imageFailure
+	changed bool
+}
+
+// Read our failures in, if we haven't already.
+func loadFailures() {
+	failures.once.Do(func() {
+		failures.byKey = map[string]imageFailure{}
+
+		data, err := ioutil.ReadFile(outputPath(failuresFile))
+		if os.IsNotExist(err) {
+			return
+		} else if err != nil {
+			slog.Warn("Could not read image failures", "error", err)
+			return
+		}
+		if err := json.Unmarshal(data, &failures.byKey); err != nil {
+			slog.Warn("Could not decode image failures", "file", failuresFile, "error", err)
+		}
+	})
+}
+
+// Look up whether we've failed to save an image under a key before.
+func lookupFailure(key string) (imageFailure, bool) {
+	loadFailures()
+	failures.mu.Lock()
+	defer failures.mu.Unlock()
+
+	f, ok := failures.byKey[key]
+	return f, ok
+}
+
+// Check whether we should try saving an image under a key this run. We give
+// up after -image-attempts, and back off between attempts until then.
+func shouldAttemptImage(key string) bool {
+	f, ok := lookupFailure(key)
+	if !ok {
+		return true
+	}
+
+	if f.Attempts >= opts.ImageAttempts {
+		slog.Debug("Given up on saving image", "key", key, "attempts", f.Attempts)
+		return false
+	}
+	if next := f.nextAttempt(); time.Now().Before(next) {
+		slog.Debug("Waiting to retry saving image", "key", key, "attempts", f.Attempts, "next_attempt", next)
+		return false
+	}
+	return true
+}
+
+// Record how trying to save an image under a key went, forgetting any
+// earlier failures once it works.
+func recordImageAttempt(key string, saved bool) {
+	loadFailures()
+	failures.mu.Lock()
+	defer failures.mu.Unlock()
+
+	if saved {
+		if _, ok := failures.byKey[key]; ok {
+			delete(failures.byKey, key)
+			failures.changed = true
+		}
+		return
+	}
+
+	f := failures.byKey[key]
+	f.Attempts++
+	f.LastAttempt = time.Now().UTC()
+	failures.byKey[key] = f
+	failures.changed = true
+}
+
+// Write our failures back out, if they've changed.
+func saveFailures() error {
+	failures.mu.Lock()
+	defer failures.mu.Unlock()
+	if !failures.changed {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(failures.byKey, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(outputPath(failuresFile), data); err != nil {
+		return err
+	}
+	failures.changed = false
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+var feedFile = filepath.Join(cacheDir, "feed.xml")
+
+// Structs for an RSS 2.0 feed of our items, with Media RSS thumbnails.
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Media   string     `xml:"xmlns:media,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	Description string        `xml:"description,omitempty"`
+	Categories  []string      `xml:"category"`
+	GUID        rssGUID       `xml:"guid"`
+	Thumbnail   *rssThumbnail `xml:"media:thumbnail,omitempty"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssThumbnail struct {
+	URL string `xml:"url,attr"`
+}
+
+// Render our items as an RSS feed, in the order they're given. Feeds need
+// absolute urls, so relative image urls are resolved against base.
+func buildFeed(items []Item, base string) ([]byte, error) {
+	feed := rss{
+		Version: "2.0",
+		Media:   "http://search.yahoo.com/mrss/",
+		Channel: rssChannel{
+			Title:       "Pocket",
+			Link:        base,
+			Description: "Items saved to Pocket",
+		},
+	}
+
+	for _, item := range items {
+		i := rssItem{
+			Title:       item.Title,
+			Link:        item.URL,
+			Description: item.Excerpt,
+			Categories:  item.Tags,
+			GUID:        rssGUID{Value: "pocket-item-" + strconv.Itoa(item.ID)},
+		}
+		if item.Image != "" {
+			i.Thumbnail = &rssThumbnail{URL: absoluteURL(base, item.Image)}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, i)
+	}
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// Handle the feed url, rendering a feed of our cached items.
+func handleFeed(w http.ResponseWriter, req *http.Request) {
+	items, err := readCachedItems(siteFrom(req.Context()).profile)
+	if err != nil {
+		slog.Error("Failed reading cache", "error", err)
+		http.Error(w, "Failed reading cache", http.StatusInternalServerError)
+		return
+	}
+
+	output, err := buildFeed(items, requestBaseURL(req))
+	if err != nil {
+		slog.Error("Failed building feed", "error", err)
+		http.Error(w, "Failed building feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(output)
+}
+
+// Get all our items and write them to the cache as an RSS feed.
+func feed() {
+	if err := checkCredentials(true); err != nil {
+		exitWithHelp(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	items, err := pocketItems(ctx, true)
+	if err != nil {
+		fatal("Failed retrieving items", "error", err)
+	}
+
+	data, err := buildFeed(items, publicURL())
+	if err != nil {
+		fatal("Failed building feed", "error", err)
+	}
+
+	if err := writeFileAtomic(outputPath(feedFile), data); err != nil {
+		fatal("Failed writing feed file", "error", err)
+	}
+
+	slog.Info("Wrote feed", "count", len(items), "file", outputPath(feedFile))
+}
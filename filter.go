@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Filter items by the query params of a request, keeping only items that match
+// all of them: type, tag, favorite (1 or 0), and q, which searches the title
+// and excerpt. Always returns a slice, so nothing matching is still [].
+func filterItems(items []Item, query url.Values) []Item {
+	itemType := query.Get("type")
+	tag := query.Get("tag")
+	search := strings.ToLower(query.Get("q"))
+
+	// An unparseable favorite is treated as not filtering by it at all.
+	favorite, err := strconv.ParseBool(query.Get("favorite"))
+	filterFavorite := err == nil
+
+	filtered := []Item{}
+	for _, item := range items {
+		if itemType != "" && !strings.EqualFold(item.Type, itemType) {
+			continue
+		}
+		if tag != "" && !contains(item.Tags, tag) {
+			continue
+		}
+		if filterFavorite && item.Favorite != favorite {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(item.Title), search) && !strings.Contains(strings.ToLower(item.Excerpt), search) {
+			continue
+		}
+		filtered = append(filtered, item)
+	}
+	return filtered
+}
+
+// A page of items, along with enough to fetch the rest of them.
+type itemsPage struct {
+	Total   int    `json:"total"`
+	Offset  int    `json:"offset"`
+	Limit   int    `json:"limit"`
+	HasMore bool   `json:"has_more"`
+	Items   []Item `json:"items"`
+}
+
+// Check whether a request asks for a page of items, rather than all of them.
+func wantsPage(query url.Values) bool {
+	for _, param := range []string{"limit", "offset", "page", "per_page"} {
+		if query.Has(param) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the page of items a request asks for, with either limit and offset, or
+// page (from 1) and per_page. A limit of 0 is everything after the offset, and
+// offsets past the end are an empty page.
+func paginateItems(items []Item, query url.Values) (itemsPage, error) {
+	limit, offset, err := pageBounds(query)
+	if err != nil {
+		return itemsPage{}, err
+	}
+
+	start := offset
+	if start > len(items) {
+		start = len(items)
+	}
+	// Compare the limit with what's left, since adding it could overflow.
+	end := len(items)
+	if limit > 0 && limit < end-start {
+		end = start + limit
+	}
+
+	return itemsPage{
+		Total:   len(items),
+		Offset:  offset,
+		Limit:   limit,
+		HasMore: end < len(items),
+		Items:   items[start:end],
+	}, nil
+}
+
+// Work out the limit and offset of the page a request asks for.
+func pageBounds(query url.Values) (int, int, error) {
+	limit, err := queryInt(query, "limit")
+	if err != nil {
+		return 0, 0, err
+	}
+	offset, err := queryInt(query, "offset")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if query.Has("page") || query.Has("per_page") {
+		page, err := queryInt(query, "page")
+		if err != nil {
+			return 0, 0, err
+		}
+		perPage, err := queryInt(query, "per_page")
+		if err != nil {
+			return 0, 0, err
+		}
+		if page < 1 {
+			page = 1
+		}
+		if perPage > 0 && page-1 > math.MaxInt/perPage {
+			return 0, 0, fmt.Errorf("invalid page %d, too far past the end with per_page %d", page, perPage)
+		}
+		limit, offset = perPage, (page-1)*perPage
+	}
+
+	return limit, offset, nil
+}
+
+// Parse a query param that has to be a whole number, which is 0 if it isn't set.
+func queryInt(query url.Values, param string) (int, error) {
+	value := query.Get(param)
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q, must be a whole number", param, value)
+	}
+	return n, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Our live items, kept in memory for a while so every request to the server
+// doesn't have to go all the way to Pocket.
+type itemsCache struct {
+	mu      sync.Mutex
+	items   []Item
+	fetched time.Time
+
+	// The fetch in progress, if there is one, for other requests to wait on.
+	fetch *itemsFetch
+
+	// The context fetches run in, cancelled when the server shuts down.
+	ctx context.Context
+}
+
+// A single fetch of items from Pocket, shared by every request that wants it.
+type itemsFetch struct {
+	done  chan struct{}
+	items []Item
+	err   error
+}
+
+var liveItems = &itemsCache{ctx: context.Background()}
+
+// Get our items, from memory if they're fresh enough and from Pocket if not.
+// Only one fetch runs at a time, requests that come in during it wait for it.
+func (c *itemsCache) get() ([]Item, error) {
+	c.mu.Lock()
+	if c.items != nil && time.Since(c.fetched) < opts.CacheTTL {
+		items := c.items
+		c.mu.Unlock()
+		return items, nil
+	}
+
+	if fetch := c.fetch; fetch != nil {
+		c.mu.Unlock()
+		<-fetch.done
+		return fetch.items, fetch.err
+	}
+
+	fetch := &itemsFetch{done: make(chan struct{})}
+	c.fetch = fetch
+	c.mu.Unlock()
+
+	// Get and process all our items from Pocket, keeping track of how it went.
+	// Never save images here, since we're on a request's path and Chrome is slow.
+	fetch.items, fetch.err = pocketItems(c.ctx, false)
+
+	// Health checks only report on the profile we were run with.
+	if c == liveItems {
+		recordFetch(fetch.err)
+	}
+
+	// Keep what we got for next time, unless it didn't work.
+	c.mu.Lock()
+	if fetch.err == nil {
+		c.items = fetch.items
+		c.fetched = time.Now()
+	}
+	c.fetch = nil
+	c.mu.Unlock()
+	close(fetch.done)
+
+	return fetch.items, fetch.err
+}
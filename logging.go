@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Levels we can log at, from the most to the least chatty.
+var validLogLevels = []string{"debug", "info", "warn", "error"}
+
+// Formats we can log in, for people or for log aggregation.
+var validLogFormats = []string{"text", "json"}
+
+// The level we're logging at, which our handler checks on every message.
+var logLevel = new(slog.LevelVar)
+
+// Send all our logs, and anything using the standard log package, through
+// slog at the given level and in the given format, which is text on a
+// terminal and JSON otherwise if it's empty.
+func setupLogging(level, format, command string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q, must be one of: %s", level, strings.Join(validLogLevels, ", "))
+	}
+	logLevel.Set(l)
+
+	if format == "" {
+		format = "json"
+		if isTerminal(os.Stderr) {
+			format = "text"
+		}
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: logLevel}
+	switch format {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, handlerOpts)))
+	case "json":
+		// Aggregated logs come from every command, so say which one each is from,
+		// and write durations like 1.5s rather than in nanoseconds.
+		handlerOpts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if a.Value.Kind() == slog.KindDuration {
+				return slog.String(a.Key, a.Value.Duration().String())
+			}
+			return a
+		}
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, handlerOpts)).With("command", command))
+	default:
+		return fmt.Errorf("invalid log format %q, must be one of: %s", format, strings.Join(validLogFormats, ", "))
+	}
+	return nil
+}
+
+// Log timing and other detail that's only wanted with -verbose.
+func logVerbose(msg string, args ...any) {
+	if opts.Verbose {
+		slog.Info(msg, args...)
+	}
+}
+
+// Log an error and exit, like log.Fatal.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// Print an error meant for a person to read, like our credentials help, and exit.
+func exitWithHelp(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
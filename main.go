@@ -1,42 +1,587 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/chromedp/cdproto/emulation"
 	"github.com/chromedp/cdproto/page"
 	"github.com/chromedp/chromedp"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const (
 	host        = "https://getpocket.com/v3"
 	retrieveUrl = host + "/get"
-)
 
-var (
-	token = os.Getenv("POCKET_ACCESS_TOKEN")
-	key   = os.Getenv("POCKET_CONSUMER_KEY")
+	// Number of items to request from the API per page.
+	pageSize = 100
+
+	// How much of a response body to log when we can't decode it.
+	maxLoggedBody = 512
+
+	// How long to wait for outstanding requests when shutting down the server.
+	shutdownTimeout = 30 * time.Second
+
+	// Remote images smaller than this are error pages or tracking pixels, not images.
+	minImageSize = 512
+
+	// Quality lossy screenshots are captured at unless -quality says otherwise.
+	defaultQuality = 95
+
+	// Headless Chrome's default viewport, used when only one dimension is given.
+	defaultWidth  = 800
+	defaultHeight = 600
+
+	// A typical phone viewport and user agent, used for -mobile.
+	mobileWidth     = 390
+	mobileHeight    = 844
+	mobileScale     = 3
+	mobileUserAgent = "Mozilla/5.0 (iPhone; CPU iPhone OS 16_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.0 Mobile/15E148 Safari/604.1"
+
+	// A typical desktop browser's user agent, since some image hosts block Go's.
+	desktopUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
 )
 
+// Our credentials, loaded from our config file, the environment, or flags.
 var (
-	generateScreenshots = true
-	outputLogs          = true
+	token string
+	key   string
 )
 
+// Item states the Pocket API knows how to filter by.
+var validStates = []string{"unread", "archive", "all"}
+
+// How much detail we can ask Pocket for about each item. Simple leaves out
+// tags, authors, images, and videos.
+var validDetails = []string{"simple", "complete"}
+
+// Orders we can sort items in. Pocket sorts by newest and oldest for us,
+// the rest we sort ourselves.
+var validSorts = []string{"newest", "oldest", "title", "site"}
+
+// Screenshot formats Chrome can capture, and the file extension for each.
+var formatExtensions = map[string]string{
+	"png":  "png",
+	"jpeg": "jpg",
+	"webp": "webp",
+}
+
+// Options that control what we retrieve from Pocket.
+type options struct {
+	ConsumerKey string
+	AccessToken string
+
+	State string
+	Tag   string
+	Sort  string
+	Addr  string
+
+	// How many items to process at once, where 0 leaves it to Concurrency.
+	Workers int
+
+	// Whether to only retrieve favorited items, and only ones matching a search.
+	FavoritesOnly bool
+	Search        string
+
+	// The url we're reached at from outside, like behind a proxy, for the
+	// urls we give out. Our address is used if it's empty.
+	PublicBaseURL string
+
+	// Whether to give out urls relative to our root, like /images/123.png,
+	// rather than absolute ones.
+	RelativeURLs bool
+
+	// How many screenshots, PDFs, and image downloads to run at once, across
+	// all our workers.
+	Concurrency int
+
+	// The most pages to load in Chrome at once, where 0 leaves it to
+	// Concurrency, and roughly how long to wait between starting them.
+	MaxPageLoads int
+	PageDelay    time.Duration
+
+	// Origins allowed to make cross-origin requests to the server, comma separated.
+	CORSOrigin string
+
+	// How long to wait for a page before giving up on its screenshot.
+	ScreenshotTimeout time.Duration
+
+	// How to wait for a page to be ready for its screenshot once it's loaded,
+	// and how much longer to wait after that.
+	Wait      string
+	WaitDelay time.Duration
+
+	// How long to wait for a Pocket request before giving up on it.
+	Timeout time.Duration
+
+	// How much detail to ask Pocket for about each item.
+	Detail string
+
+	// How many times to try a Pocket request, and how long to wait before
+	// the first retry (doubling each time after).
+	MaxAttempts int
+	RetryDelay  time.Duration
+
+	// Directory to keep our cache and images in, which is the working
+	// directory by default.
+	OutputDir string
+
+	// Whether to write our cached items as a bare array, like we used to,
+	// rather than wrapped up with their version.
+	LegacyArray bool
+
+	// Whether to only get items that changed since our last run, and the
+	// file we keep the state of our last run in, which is in our cache if unset.
+	Since     bool
+	SinceFile string
+
+	// Format to write our items out as, on top of the JSON cache.
+	Output string
+
+	// How many items to process, after sorting them, where 0 is all of them.
+	Limit int
+
+	// Only process items added at or after, and before, these times, which are
+	// dates or how long ago. Either can be empty.
+	AddedAfter  string
+	AddedBefore string
+
+	// How many days of items to put in a digest.
+	DigestDays int
+
+	// Reading speed used to estimate reading time.
+	WordsPerMinute int
+
+	// Image format to capture screenshots in, and the quality for lossy ones.
+	Format  string
+	Quality int
+
+	// Whether to capture the full scrolling page rather than just the viewport.
+	FullPage bool
+
+	// Aspect ratio to crop screenshots to from the top of the page, like 16:9,
+	// rather than capturing the viewport as it is.
+	Aspect string
+
+	// Viewport to take screenshots at, where zero leaves Chrome's default,
+	// and whether to emulate a phone.
+	Width  int
+	Height int
+	Scale  float64
+	Mobile bool
+
+	// A file of cookies to set on the pages we screenshot, like logins for
+	// paywalled sites, either a JSON array or a Netscape cookies.txt.
+	CookieFile string
+
+	// Whether to take screenshots with pages in dark mode.
+	Dark bool
+
+	// Whether to save a PDF of each item's page too.
+	PDF bool
+
+	// Whether to block ads and trackers, and dismiss overlays, for screenshots.
+	Clean bool
+
+	// The largest remote image we'll download, in bytes.
+	MaxImageSize int64
+
+	// Whether to embed saved images in items as data urls, rather than linking
+	// to them, and the largest image to embed.
+	EmbedImages  bool
+	EmbedMaxSize int64
+
+	// How long to wait for a remote image or page, and who to say we are when
+	// asking for it, which Chrome says too.
+	ImageTimeout time.Duration
+	UserAgent    string
+
+	// How many times to try saving an image for an item, across runs, and
+	// how long to wait before retrying, doubling each time after.
+	ImageAttempts   int
+	ImageRetryDelay time.Duration
+
+	// Whether to strip tracking params, like utm_source, from item urls.
+	StripTracking bool
+
+	// Whether to leave out items Pocket hasn't resolved yet, rather than
+	// keeping them without images until it has.
+	SkipUnresolved bool
+
+	// Whether to check if the sources of remote images we've saved have
+	// changed, downloading them again if they have.
+	Revalidate bool
+
+	// Whether to log how long each stage of our work takes.
+	Verbose bool
+
+	// The profile from our config file to use, for another Pocket account,
+	// with its own cache and images. The default account has no profile.
+	Profile string
+
+	// Whether to only log what we'd do, rather than doing it.
+	DryRun bool
+
+	// The least important level of message to log.
+	LogLevel string
+
+	// Whether to log text or JSON, where empty picks based on whether we're on a terminal.
+	LogFormat string
+
+	// Whether to save images and screenshots for items that don't have one yet.
+	Screenshots bool
+
+	// Whether items saved from the same url share their images.
+	Dedupe bool
+
+	// Comma separated tags to add items with.
+	Tags string
+
+	// How long the server keeps live items in memory before fetching them again.
+	CacheTTL time.Duration
+
+	// How often the server refreshes its cache in the background, where 0 never does.
+	Refresh time.Duration
+
+	// Secret for triggering a refresh at /api/refresh, where empty turns it off.
+	RefreshToken string
+
+	// Where we keep our cached items, a JSON file or a SQLite database.
+	Store string
+}
+
+// Our options, set up with their defaults.
+var opts = options{
+	State:       "unread",
+	Sort:        "newest",
+	Addr:        "localhost:4000",
+	Concurrency: runtime.NumCPU(),
+	DigestDays:  7,
+
+	ScreenshotTimeout: 30 * time.Second,
+	Wait:              "networkidle",
+	ImageAttempts:     3,
+	StripTracking:     true,
+	ImageRetryDelay:   time.Hour,
+	Timeout:           30 * time.Second,
+	Detail:            "complete",
+	MaxAttempts:       3,
+	RetryDelay:        time.Second,
+	Format:            "png",
+	Quality:           defaultQuality,
+	Output:            "json",
+	WordsPerMinute:    200,
+	MaxImageSize:      5 << 20,
+	EmbedMaxSize:      256 << 10,
+	ImageTimeout:      15 * time.Second,
+	UserAgent:         desktopUserAgent,
+	LogLevel:          "info",
+	Screenshots:       true,
+	CacheTTL:          5 * time.Minute,
+	Store:             "json",
+	OutputDir:         ".",
+}
+
+// Profile names, which we use as directory names.
+var validProfile = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Make sure our options are ones the Pocket API will accept.
+func (o options) validate() error {
+	if !contains(validStates, o.State) {
+		return fmt.Errorf("invalid state %q, must be one of: %s", o.State, strings.Join(validStates, ", "))
+	}
+
+	if !contains(validDetails, o.Detail) {
+		return fmt.Errorf("invalid detail %q, must be one of: %s", o.Detail, strings.Join(validDetails, ", "))
+	}
+
+	if !contains(validSorts, o.Sort) {
+		return fmt.Errorf("invalid sort %q, must be one of: %s", o.Sort, strings.Join(validSorts, ", "))
+	}
+
+	if o.Workers < 0 {
+		return fmt.Errorf("invalid workers %d, must not be negative", o.Workers)
+	}
+
+	if o.Concurrency < 1 {
+		return fmt.Errorf("invalid concurrency %d, must be at least 1", o.Concurrency)
+	}
+
+	if o.ImageAttempts < 1 {
+		return fmt.Errorf("invalid image attempts %d, must be at least 1", o.ImageAttempts)
+	}
+
+	if o.ImageRetryDelay < 0 {
+		return fmt.Errorf("invalid image retry delay %s, must not be negative", o.ImageRetryDelay)
+	}
+
+	if o.MaxPageLoads < 0 {
+		return fmt.Errorf("invalid max page loads %d, must not be negative", o.MaxPageLoads)
+	}
+
+	if o.PageDelay < 0 {
+		return fmt.Errorf("invalid page delay %s, must not be negative", o.PageDelay)
+	}
+
+	if !contains(validStores, o.Store) {
+		return fmt.Errorf("invalid store %q, must be one of: %s", o.Store, strings.Join(validStores, ", "))
+	}
+
+	if !contains(validOutputs, o.Output) {
+		return fmt.Errorf("invalid output %q, must be one of: %s", o.Output, strings.Join(validOutputs, ", "))
+	}
+
+	if _, ok := formatExtensions[o.Format]; !ok {
+		return fmt.Errorf("invalid format %q, must be one of: png, jpeg, webp", o.Format)
+	}
+
+	if strings.TrimSpace(o.UserAgent) == "" {
+		return fmt.Errorf("invalid user agent, must not be empty")
+	}
+
+	if o.Quality < 0 || o.Quality > 100 {
+		return fmt.Errorf("invalid quality %d, must be from 0 to 100", o.Quality)
+	}
+
+	if o.Aspect != "" {
+		if _, _, err := parseAspect(o.Aspect); err != nil {
+			return err
+		}
+		if o.FullPage {
+			return fmt.Errorf("-aspect can't be used with -fullpage")
+		}
+	}
+
+	if o.Width < 0 || o.Height < 0 || o.Scale < 0 {
+		return fmt.Errorf("invalid viewport %dx%d@%gx, must not be negative", o.Width, o.Height, o.Scale)
+	}
+
+	if o.Limit < 0 {
+		return fmt.Errorf("invalid limit %d, must not be negative", o.Limit)
+	}
+
+	if o.DigestDays < 1 {
+		return fmt.Errorf("invalid days %d, must be at least 1", o.DigestDays)
+	}
+
+	if o.AddedAfter != "" || o.AddedBefore != "" {
+		after, before, err := addedRange(o, time.Now())
+		if err != nil {
+			return err
+		}
+		if !after.IsZero() && !before.IsZero() && !after.Before(before) {
+			return fmt.Errorf("-added-after %s must be before -added-before %s", o.AddedAfter, o.AddedBefore)
+		}
+
+		// Syncing merges into the cache, which would keep everything outside the range.
+		if o.Since {
+			return fmt.Errorf("-added-after and -added-before can't be used with -since")
+		}
+	}
+
+	if o.EmbedMaxSize < 0 {
+		return fmt.Errorf("invalid embed max size %d, must not be negative", o.EmbedMaxSize)
+	}
+
+	if o.EmbedImages && o.Output == "manifest" {
+		return fmt.Errorf("-embed-images can't be used with -output manifest, which lists image files")
+	}
+
+	if o.MaxImageSize < minImageSize {
+		return fmt.Errorf("invalid max image size %d, must be at least %d bytes", o.MaxImageSize, minImageSize)
+	}
+
+	if o.WordsPerMinute < 1 {
+		return fmt.Errorf("invalid words per minute %d, must be at least 1", o.WordsPerMinute)
+	}
+
+	if o.MaxAttempts < 1 {
+		return fmt.Errorf("invalid max attempts %d, must be at least 1", o.MaxAttempts)
+	}
+
+	if o.Timeout <= 0 {
+		return fmt.Errorf("invalid timeout %s, must be greater than 0", o.Timeout)
+	}
+
+	if o.ScreenshotTimeout <= 0 {
+		return fmt.Errorf("invalid screenshot timeout %s, must be greater than 0", o.ScreenshotTimeout)
+	}
+
+	if !contains(validWaits, o.Wait) {
+		return fmt.Errorf("invalid wait %q, must be one of: %s", o.Wait, strings.Join(validWaits, ", "))
+	}
+
+	if o.WaitDelay < 0 {
+		return fmt.Errorf("invalid wait delay %s, must not be negative", o.WaitDelay)
+	}
+
+	if o.Refresh < 0 {
+		return fmt.Errorf("invalid refresh interval %s, must not be negative", o.Refresh)
+	}
+
+	if o.CacheTTL < 0 {
+		return fmt.Errorf("invalid cache ttl %s, must not be negative", o.CacheTTL)
+	}
+
+	if o.ImageTimeout <= 0 {
+		return fmt.Errorf("invalid image timeout %s, must be greater than 0", o.ImageTimeout)
+	}
+
+	if _, _, err := net.SplitHostPort(o.Addr); err != nil {
+		return fmt.Errorf("invalid address %q: %w", o.Addr, err)
+	}
+
+	if o.Profile != "" && !validProfile.MatchString(o.Profile) {
+		return fmt.Errorf("invalid profile %q, must only have letters, numbers, dashes, and underscores", o.Profile)
+	}
+	if contains(reservedProfiles, o.Profile) {
+		return fmt.Errorf("invalid profile %q, must not be one of: %s", o.Profile, strings.Join(reservedProfiles, ", "))
+	}
+
+	if o.PublicBaseURL != "" {
+		u, err := url.Parse(o.PublicBaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid public base url %q, must be an http or https url", o.PublicBaseURL)
+		}
+	}
+
+	return nil
+}
+
+// Build the base url our server, and the images it serves, are available at.
+func baseURL() string {
+	host, port, _ := net.SplitHostPort(opts.Addr)
+
+	// If we're listening on every interface, use our hostname instead.
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+		if hostname, err := os.Hostname(); err == nil {
+			host = hostname
+		}
+	}
+
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// Build the base url people reach us at, which is -public-base-url when we're
+// behind a proxy, and our own address otherwise.
+func publicURL() string {
+	if opts.PublicBaseURL != "" {
+		return strings.TrimRight(opts.PublicBaseURL, "/")
+	}
+	return baseURL()
+}
+
+// Build the url we serve one of a profile's files at, from its path under its
+// root. Profiles are served under their name, like /work/images/123.png.
+// With -relative-urls that's just the path, so it works wherever we're served.
+// Urls always use forward slashes, whatever our paths on disk look like.
+func fileURL(profile, p string) string {
+	if profile != "" {
+		p = path.Join(profile, p)
+	}
+	if opts.RelativeURLs {
+		return "/" + p
+	}
+	return publicURL() + "/" + p
+}
+
+// Build the url we serve one of a profile's images at.
+func imageURL(profile, name string) string {
+	return fileURL(profile, path.Join(imagesDir, name))
+}
+
+// Build the base url a request reached us at, for resolving relative urls in
+// what we send back to it.
+func requestBaseURL(req *http.Request) string {
+	if opts.PublicBaseURL != "" {
+		return publicURL()
+	}
+
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host
+}
+
+// Resolve a url against a base url, if it's relative.
+func absoluteURL(base, link string) string {
+	if strings.HasPrefix(link, "/") {
+		return strings.TrimRight(base, "/") + link
+	}
+	return link
+}
+
+// Check if a string is in a list of strings.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 // Struct for Results of our main retrieve query.
 type Result struct {
 	List     map[string]ResultItem
 	Status   int
 	Complete int
 	Since    int
+
+	// The rate limits Pocket reported with the (last) response.
+	RateLimit RateLimit `json:"-"`
+}
+
+// Decode our results, accounting for Pocket sending an empty list as an
+// array ([]) rather than an object ({}).
+func (r *Result) UnmarshalJSON(data []byte) error {
+	// Use an alias type so we don't recurse back into this method.
+	type result Result
+	aux := struct {
+		*result
+		List json.RawMessage
+	}{result: (*result)(r)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	// Anything other than an object (an array, null, or nothing at all) is an empty list.
+	r.List = map[string]ResultItem{}
+	list := bytes.TrimSpace(aux.List)
+	if len(list) == 0 || list[0] != '{' {
+		return nil
+	}
+
+	return json.Unmarshal(list, &r.List)
 }
 
 // Struct for each item of our main retrieve query.
@@ -55,6 +600,8 @@ type ResultItem struct {
 	HasVideo      int    `json:"has_video,string"`
 	WordCount     int    `json:"word_count,string"`
 	TopImageURL   string `json:"top_image_url"`
+	TimeAdded     int64  `json:"time_added,string"`
+	TimeUpdated   int64  `json:"time_updated,string"`
 	Tags          map[string]map[string]interface{}
 	Authors       map[string]map[string]interface{}
 	Images        map[string]map[string]interface{}
@@ -62,329 +609,1488 @@ type ResultItem struct {
 	SortID        int `json:"sort_id"`
 }
 
-// Struct for a single item in our response.
-type Item struct {
-	ID      int    `json:"item_id"`
-	Title   string `json:"title"`
-	URL     string `json:"url"`
-	Excerpt string `json:"excerpt"`
-	Type    string `json:"type"`
-	SortID  int    `json:"sort_id"`
-	Image   string `json:"image"`
+// Struct for a single item in our response.
+type Item struct {
+	ID        int      `json:"item_id"`
+	Title     string   `json:"title"`
+	URL       string   `json:"url"`
+	Excerpt   string   `json:"excerpt"`
+	Type      string   `json:"type"`
+	SortID    int      `json:"sort_id"`
+	Image     string   `json:"image"`
+	Thumbnail string   `json:"thumbnail"`
+	PDF       string   `json:"pdf"`
+	WordCount int      `json:"word_count"`
+	Favorite  bool     `json:"favorite"`
+	Tags      []string `json:"tags"`
+
+	ReadingTimeMinutes int `json:"reading_time_minutes"`
+
+	TimeAdded   time.Time `json:"time_added"`
+	TimeUpdated time.Time `json:"time_updated"`
+}
+
+// Our client for the Pocket API, set up once our options are parsed.
+var pocketClient = &http.Client{}
+
+// Get all items in a state from the Pocket API, paging through until the list
+// is exhausted. If since is set, only items that have changed since then are
+// retrieved. Cancelling the context stops us, even in the middle of a request.
+func retrievePocketItems(ctx context.Context, since int, state string) (Result, error) {
+	// Every page gets merged into a single combined result.
+	results := Result{List: map[string]ResultItem{}}
+	start := time.Now()
+
+	for offset := 0; ; offset += pageSize {
+		batch, err := retrievePocketPage(ctx, offset, since, state)
+		if err != nil {
+			return results, err
+		}
+
+		slog.Info("Retrieved items", "count", len(batch.List), "offset", offset)
+		slog.Info("Rate limit remaining", "rate_limit", batch.RateLimit.String())
+		results.RateLimit = batch.RateLimit
+
+		// The first page tells us the status of the list and when it was retrieved.
+		if offset == 0 {
+			results.Status = batch.Status
+			results.Complete = batch.Complete
+			results.Since = batch.Since
+		}
+
+		// Pocket sets the status to 2 (and may send an empty list) when there are no more items.
+		if batch.Status != 1 || len(batch.List) == 0 {
+			break
+		}
+
+		// Sort IDs start over on every page, so offset them to keep the overall order.
+		for id, item := range batch.List {
+			item.SortID += offset
+			results.List[id] = item
+		}
+
+		// A short page means we've reached the end of the list.
+		if len(batch.List) < pageSize {
+			break
+		}
+
+		// If we've used up our requests, wait for them to reset rather than getting blocked.
+		if wait := batch.RateLimit.wait(); wait > 0 {
+			slog.Warn("Rate limit reached, waiting for it to reset", "wait", wait)
+			if err := sleepContext(ctx, wait); err != nil {
+				return results, err
+			}
+		}
+	}
+
+	logVerbose("Retrieved all items from Pocket", "count", len(results.List), "duration", time.Since(start).Round(time.Millisecond))
+	return results, nil
+}
+
+// Get a single page of items from the Pocket API, starting at the given offset.
+func retrievePocketPage(ctx context.Context, offset int, since int, state string) (Result, error) {
+	// Start our request to the retrieve endpoint.
+	req, err := http.NewRequestWithContext(ctx, "GET", retrieveUrl, nil)
+	if err != nil {
+		return Result{}, fmt.Errorf("building request for %s: %w", retrieveUrl, err)
+	}
+
+	// Build up our query args for the request, including our key/token for access.
+	q := req.URL.Query()
+	s := siteFrom(ctx)
+	q.Add("consumer_key", s.key)
+	q.Add("access_token", s.token)
+	q.Add("detailType", opts.Detail)
+	q.Add("state", state)
+	if opts.Tag != "" {
+		q.Add("tag", opts.Tag)
+	}
+	if opts.FavoritesOnly {
+		q.Add("favorite", "1")
+	}
+	if opts.Search != "" {
+		q.Add("search", opts.Search)
+	}
+	q.Add("sort", pocketSort())
+	q.Add("count", strconv.Itoa(pageSize))
+	q.Add("offset", strconv.Itoa(offset))
+	if since > 0 {
+		q.Add("since", strconv.Itoa(since))
+	}
+	req.URL.RawQuery = q.Encode()
+
+	slog.Debug("Retrieving items", "url", retrieveUrl, "offset", offset)
+
+	// Perform the request, retrying if Pocket is having trouble.
+	start := time.Now()
+	resp, err := doWithRetry(pocketClient, req)
+	if err != nil {
+		return Result{}, requestError(retrieveUrl, err)
+	}
+	defer resp.Body.Close()
+	slog.Debug("Retrieved page", "offset", offset, "status", resp.StatusCode, "duration", time.Since(start))
+
+	// Make sure we get a valid response. Searching more than titles and urls
+	// needs Premium, which Pocket tells us about as a refusal.
+	if resp.StatusCode != 200 {
+		pocketErr := resp.Header.Get("X-Error")
+		if opts.Search != "" && (resp.StatusCode == http.StatusForbidden || strings.Contains(strings.ToLower(pocketErr), "premium")) {
+			return Result{}, fmt.Errorf("Pocket wouldn't search for %q, full-text search needs a Pocket Premium account (without one, -search only matches titles and urls): %s %s", opts.Search, resp.Status, pocketErr)
+		}
+		return Result{}, fmt.Errorf("did not get 200 for %s: %s %s", retrieveUrl, resp.Status, pocketErr)
+	}
+
+	// Read the response of our request.
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Result{}, fmt.Errorf("reading body from %s: %w", retrieveUrl, err)
+	}
+
+	// Unmarshal our response and pass it on, logging what we got if it isn't what we expected.
+	var results Result
+	results.RateLimit = parseRateLimit(resp.Header)
+	if err := json.Unmarshal(bodyBytes, &results); err != nil {
+		body := string(bodyBytes)
+		if len(body) > maxLoggedBody {
+			body = body[:maxLoggedBody] + "..."
+		}
+		slog.Error("Could not decode response", "error", err, "body", body)
+		return results, fmt.Errorf("decoding Pocket response: %w", err)
+	}
+
+	return results, nil
+}
+
+// Perform a request, retrying network errors, 5xx, and 429 responses with
+// exponential backoff. Any other response, including a 4xx, is returned as-is.
+func doWithRetry(client *http.Client, req *http.Request) (*http.Response, error) {
+	delay := opts.RetryDelay
+	for attempt := 1; ; attempt++ {
+		resp, err := client.Do(req)
+		countPocketRequest(req, resp, err)
+		retry := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if !retry || attempt >= opts.MaxAttempts {
+			return resp, err
+		}
+
+		// When we're rate limited, Pocket may tell us how long to wait.
+		wait := delay
+		if resp != nil {
+			if after := retryAfter(resp); after > 0 {
+				wait = after
+			}
+			resp.Body.Close()
+		}
+
+		slog.Warn("Retrying request", "path", req.URL.Path, "wait", wait, "attempt", attempt+1, "max_attempts", opts.MaxAttempts)
+
+		if err := sleepContext(req.Context(), wait); err != nil {
+			return nil, err
+		}
+		delay *= 2
+	}
+}
+
+// Wait for a while, unless the context is done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Wrap an error from requesting a Pocket endpoint, saying plainly when it's
+// because the request took too long.
+func requestError(endpoint string, err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("timed out after %s requesting %s: %w", opts.Timeout, endpoint, err)
+	}
+	return fmt.Errorf("requesting %s: %w", endpoint, err)
+}
+
+// Get how long a 429 response asks us to wait, from its Retry-After header,
+// which is either a number of seconds or a date.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return 0
+	}
+
+	header := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
+
+// Post a JSON body to a Pocket endpoint, decoding the JSON response into out.
+func postPocket(endpoint string, body interface{}, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("encoding request for %s: %w", endpoint, err)
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("building request for %s: %w", endpoint, err)
+	}
+
+	// Pocket responds with form values unless we ask for JSON.
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Accept", "application/json")
+
+	resp, err := pocketClient.Do(req)
+	countPocketRequest(req, resp, err)
+	if err != nil {
+		return requestError(endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	// Pocket explains what went wrong in the X-Error header.
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("did not get 200 for %s: %s %s", endpoint, resp.Status, resp.Header.Get("X-Error"))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response from %s: %w", endpoint, err)
+	}
+
+	return nil
+}
+
+// Create the directories we keep our cache and images in, under our output directory.
+func ensureDirs() error {
+	for _, dir := range []string{cacheDir, imagesDir, pdfDir} {
+		if err := os.MkdirAll(outputPath(dir), 0o755); err != nil {
+			return fmt.Errorf("creating %s directory: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// Write a file by writing to a temporary file next to it, then renaming it
+// into place, so anyone reading it sees either the old or the new contents.
+func writeFileAtomic(filename string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+"-*")
+	if err != nil {
+		return err
+	}
+
+	// Clean up the temporary file if anything goes wrong before the rename.
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// Temporary files are only readable by us, so match a normally created file.
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// Check if a file exists locally.
+func fileExists(filename string) bool {
+	if _, err := os.Stat(filename); err != nil {
+		if os.IsNotExist(err) {
+			return false
+		}
+	}
+	return true
+}
+
+// Trigger a headless Chrome request to take a screenshot.
+func chromeTakeScreenshot(url string, imageBuf *[]byte) chromedp.Tasks {
+	return chromedp.Tasks{
+		emulateUserAgent(),
+		emulateDevice(),
+		emulateColorScheme(),
+		blockTrackers(),
+		injectCookies(url),
+		navigateAndWait(url),
+		dismissOverlays(),
+		chromedp.ActionFunc(func(ctx context.Context) (err error) {
+			params := screenshotParams()
+
+			// Capture the whole scrolling page rather than just the viewport.
+			if opts.FullPage {
+				clip, err := fullPageClip(ctx)
+				if err != nil {
+					return err
+				}
+				params = params.WithCaptureBeyondViewport(true).WithClip(clip)
+			}
+
+			// Or crop from the top of the page to our aspect ratio.
+			if opts.Aspect != "" {
+				clip, err := aspectClip(ctx)
+				if err != nil {
+					return err
+				}
+				params = params.WithCaptureBeyondViewport(true).WithClip(clip)
+			}
+
+			*imageBuf, err = params.Do(ctx)
+			return err
+		}),
+	}
+}
+
+// Tell pages we prefer a dark color scheme, if we want dark screenshots, so
+// sites that support it render their dark variant.
+func emulateColorScheme() chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if !opts.Dark {
+			return nil
+		}
+
+		return emulation.SetEmulatedMedia().WithFeatures([]*emulation.MediaFeature{
+			{Name: "prefers-color-scheme", Value: "dark"},
+		}).Do(ctx)
+	})
+}
+
+// Tell pages we're our -user-agent, like our image downloads do, or a phone
+// with -mobile unless we've been given one.
+func emulateUserAgent() chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		userAgent := opts.UserAgent
+		if opts.Mobile && userAgent == desktopUserAgent {
+			userAgent = mobileUserAgent
+		}
+		return emulation.SetUserAgentOverride(userAgent).Do(ctx)
+	})
+}
+
+// Emulate our configured viewport and device, if we have one, before navigating.
+func emulateDevice() chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		width, height, scale := opts.Width, opts.Height, opts.Scale
+
+		// Fill in a phone viewport for anything not given.
+		if opts.Mobile {
+			if width == 0 {
+				width = mobileWidth
+			}
+			if height == 0 {
+				height = mobileHeight
+			}
+			if scale == 0 {
+				scale = mobileScale
+			}
+		}
+
+		// Keep Chrome's default viewport if nothing was specified.
+		if width == 0 && height == 0 && scale == 0 {
+			return nil
+		}
+
+		if width == 0 {
+			width = defaultWidth
+		}
+		if height == 0 {
+			height = defaultHeight
+		}
+		if scale == 0 {
+			scale = 1
+		}
+
+		viewportOpts := []chromedp.EmulateViewportOption{chromedp.EmulateScale(scale)}
+		if opts.Mobile {
+			viewportOpts = append(viewportOpts, chromedp.EmulateMobile)
+		}
+
+		return chromedp.EmulateViewport(int64(width), int64(height), viewportOpts...).Do(ctx)
+	})
+}
+
+// Get the region covering the full scroll height of the page.
+func fullPageClip(ctx context.Context) (*page.Viewport, error) {
+	_, _, contentSize, _, _, cssContentSize, err := page.GetLayoutMetrics().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Newer versions of Chrome report the content size in CSS pixels separately.
+	if cssContentSize != nil {
+		contentSize = cssContentSize
+	}
+
+	return &page.Viewport{
+		X:      contentSize.X,
+		Y:      contentSize.Y,
+		Width:  contentSize.Width,
+		Height: contentSize.Height,
+		Scale:  1,
+	}, nil
+}
+
+// Get the region at the top of the page, as wide as the viewport, that fits
+// our aspect ratio. It can run past the bottom of the viewport for tall ratios.
+func aspectClip(ctx context.Context) (*page.Viewport, error) {
+	layoutViewport, _, _, cssLayoutViewport, _, _, err := page.GetLayoutMetrics().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Newer versions of Chrome report the viewport in CSS pixels separately.
+	if cssLayoutViewport != nil {
+		layoutViewport = cssLayoutViewport
+	}
+
+	width, height, _ := parseAspect(opts.Aspect)
+	return &page.Viewport{
+		X:      0,
+		Y:      0,
+		Width:  float64(layoutViewport.ClientWidth),
+		Height: math.Round(float64(layoutViewport.ClientWidth) * height / width),
+		Scale:  1,
+	}, nil
+}
+
+// Parse an aspect ratio like 16:9 into its width and height.
+func parseAspect(aspect string) (float64, float64, error) {
+	w, h, ok := strings.Cut(aspect, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid aspect ratio %q, must be like 16:9", aspect)
+	}
+
+	width, err := strconv.ParseFloat(w, 64)
+	if err != nil || width <= 0 {
+		return 0, 0, fmt.Errorf("invalid aspect ratio %q, must be like 16:9", aspect)
+	}
+	height, err := strconv.ParseFloat(h, 64)
+	if err != nil || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid aspect ratio %q, must be like 16:9", aspect)
+	}
+	return width, height, nil
+}
+
+// Build the parameters to capture a screenshot in our configured format.
+func screenshotParams() *page.CaptureScreenshotParams {
+	// Our version of cdproto doesn't have a constant for webp, so use the format name as-is.
+	params := page.CaptureScreenshot().WithFormat(page.CaptureScreenshotFormat(opts.Format))
+
+	// Quality only applies to lossy formats.
+	if opts.Format != "png" {
+		params = params.WithQuality(int64(opts.Quality))
+	}
+
+	return params
+}
+
+// A single headless Chrome shared by every screenshot in a run. It isn't
+// started until the first screenshot needs it.
+type browser struct {
+	once   sync.Once
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+	err    error
+}
+
+// Start up our instance of Chrome, which is shut down if our parent context is cancelled.
+func (b *browser) start() {
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(b.parent, chromedp.DefaultExecAllocatorOptions[:]...)
+	ctx, cancelCtx := chromedp.NewContext(allocCtx)
+	b.ctx = ctx
+	b.cancel = func() {
+		cancelCtx()
+		cancelAlloc()
+	}
+
+	// Running without any actions launches the browser, so every tab we open shares it.
+	b.err = chromedp.Run(ctx)
+}
+
+// Open a new tab in our browser, starting it if it isn't running yet.
+// Cancelling the returned context closes the tab.
+func (b *browser) newTab() (context.Context, context.CancelFunc, error) {
+	b.once.Do(b.start)
+	if b.err != nil {
+		return nil, nil, b.err
+	}
+
+	ctx, cancel := chromedp.NewContext(b.ctx)
+	return ctx, cancel, nil
+}
+
+// Shut down the browser once we're done with it, if it was ever started.
+func (b *browser) close() {
+	if b.cancel != nil {
+		b.cancel()
+	}
+}
+
+// Save a screenshot for a url, in a new tab of our browser.
+func saveScreenshot(b *browser, url string, filename string) (saved bool) {
+	// Wait our turn to load a page before taking a work slot, so waiting
+	// doesn't hold up image downloads.
+	done, err := startPageLoad(b.parent)
+	if err != nil {
+		return false
+	}
+	defer done()
+	defer acquireSlot()()
+	slog.Debug("Saving screenshot", "file", filename, "url", url)
+	start := time.Now()
+	defer func() { countScreenshot(saved, start) }()
+
+	// Open a tab in our instance of Chrome.
+	ctx, cancel, err := b.newTab()
+	if err != nil {
+		slog.Error("Could not start Chrome", "file", filename, "error", err)
+		return false
+	}
+	defer cancel()
+
+	// Don't let a page that never finishes loading hold us up forever.
+	ctx, cancelTimeout := context.WithTimeout(ctx, opts.ScreenshotTimeout)
+	defer cancelTimeout()
+
+	// Start an image buffer and take a screenshot.
+	var imageBuf []byte
+	if err := chromedp.Run(ctx, chromeTakeScreenshot(url, &imageBuf)); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			slog.Warn("Timed out taking screenshot", "url", url, "timeout", opts.ScreenshotTimeout)
+		} else {
+			slog.Warn("Could not take screenshot", "url", url, "error", err, "duration", time.Since(start))
+		}
+		return false
+	}
+
+	// Write our image to the local filesystem.
+	if err := ioutil.WriteFile(filename, imageBuf, 0o644); err != nil {
+		slog.Error("Could not write screenshot", "file", filename, "error", err)
+		return false
+	}
+
+	slog.Debug("Saved screenshot", "file", filename, "url", url, "duration", time.Since(start))
+	return true
+}
+
+// Slots for our slow Chrome and download work, shared by every worker so
+// -concurrency bounds it all, even when the server is processing items twice.
+var workSlots chan struct{}
+
+// Wait for a free work slot, returning a function that frees it again.
+func acquireSlot() func() {
+	workSlots <- struct{}{}
+	return func() { <-workSlots }
 }
 
-// Get all items from the Pocket API.
-func retrievePocketItems() Result {
-	// Set up an HTTP client.
-	client := &http.Client{}
+// Our client for fetching remote images and pages, set up once our options are parsed.
+var remoteClient = &http.Client{}
 
-	// Start our request to the retrieve endpoint.
-	req, err := http.NewRequest("GET", retrieveUrl, nil)
+// Fetch a remote image or page the way a browser would, with any extra headers.
+func getRemote(src string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, src, nil)
 	if err != nil {
-		log.Fatalf("Error building request  %s\n", req.URL)
-		log.Fatal(err)
+		return nil, err
 	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", opts.UserAgent)
 
-	// Build up our query args for the request, including our key/token for access.
-	q := req.URL.Query()
-	q.Add("consumer_key", key)
-	q.Add("access_token", token)
-	q.Add("detailType", "complete")
-	q.Add("state", "unread")
-	q.Add("sort", "newest")
-	req.URL.RawQuery = q.Encode()
+	return remoteClient.Do(req)
+}
 
-	if outputLogs {
-		fmt.Printf("Retrieving %s\n", req.URL)
-	}
+// Save a remote image to our local filesystem.
+func saveRemoteImage(src, filename string) bool {
+	saved, _ := downloadImage(src, filename, imageValidator{})
+	return saved
+}
+
+// Download a remote image to our local filesystem, unless the validators we
+// have for it say it hasn't changed since we last did.
+func downloadImage(src, filename string, cached imageValidator) (saved, unchanged bool) {
+	defer acquireSlot()()
+	slog.Debug("Saving image", "file", filename, "url", src)
+	start := time.Now()
+	defer func() {
+		if !unchanged {
+			remoteImages.WithLabelValues(resultLabel(saved)).Inc()
+			stats.downloads.Add(1)
+		}
+	}()
 
-	// Perform the request.
-	resp, err := client.Do(req)
+	// Start our http request.
+	resp, err := getRemote(src, cached.header())
 	if err != nil {
-		log.Fatalf("Error getting request  %s\n", req.URL)
-		log.Fatal(err)
+		slog.Warn("Image request failed", "url", src, "error", err)
+		return false, false
 	}
 	defer resp.Body.Close()
 
-	// Make sure we get a valid response.
+	if resp.StatusCode == http.StatusNotModified {
+		slog.Debug("Image unchanged", "file", filename, "url", src)
+		return false, true
+	}
+
+	// Make sure we got a valid response.
 	if resp.StatusCode != 200 {
-		log.Fatalf("Did not get 200 for request  %s\n", req.URL)
-		log.Fatal(err)
+		slog.Warn("Did not get 200 status for image", "url", src, "status", resp.StatusCode)
+		return false, false
 	}
 
-	// Read the response of our request.
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	// Read the image in, so we can check what it is before saving it. We read
+	// one byte past our limit so we can tell when an image goes over it.
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, opts.MaxImageSize+1))
 	if err != nil {
-		log.Fatalf("Error reading body  %s\n", req.URL)
-		log.Fatal(err)
+		slog.Warn("Could not read image", "url", src, "error", err)
+		return false, false
 	}
 
-	// Unmarshal our response and pass it on.
-	var results Result
-	json.Unmarshal(bodyBytes, &results)
-	return results
-}
+	// Nothing is written until we've read the whole image, so there's no partial file to clean up.
+	if int64(len(data)) > opts.MaxImageSize {
+		slog.Warn("Image too large", "url", src, "max_bytes", opts.MaxImageSize)
+		return false, false
+	}
 
-// Check if a file exists locally.
-func fileExists(filename string) bool {
-	if _, err := os.Stat(filename); err != nil {
-		if os.IsNotExist(err) {
-			return false
-		}
+	// Error pages and tracking pixels aren't worth keeping, a screenshot is better.
+	if len(data) < minImageSize {
+		slog.Info("Image too small", "url", src, "bytes", len(data))
+		return false, false
 	}
-	return true
+	if contentType := http.DetectContentType(data); !strings.HasPrefix(contentType, "image/") {
+		slog.Info("Not an image", "url", src, "content_type", contentType)
+		return false, false
+	}
+
+	// Write the remote image to our local file.
+	if err := writeFileAtomic(filename, data); err != nil {
+		slog.Error("Could not write image", "file", filename, "error", err)
+		return false, false
+	}
+
+	rememberValidator(filename, src, resp.Header)
+	slog.Debug("Saved image", "file", filename, "url", src, "duration", time.Since(start))
+	return true, false
 }
 
-// Trigger a headless Chrome request to take a screenshot.
-func chromeTakeScreenshot(url string, imageBuf *[]byte) chromedp.Tasks {
-	return chromedp.Tasks{
-		chromedp.Navigate(url),
-		chromedp.ActionFunc(func(ctx context.Context) (err error) {
-			*imageBuf, err = page.CaptureScreenshot().WithQuality(95).Do(ctx)
-			return err
-		}),
+// Describe how we'd save an image for an item, for -dry-run. It's only a guess
+// when we'd look for a thumbnail, since finding one means fetching the page.
+func plannedImage(item ResultItem, saved bool) string {
+	switch {
+	case saved:
+		return "image already saved"
+	case item.HasImage == 2:
+		return "would download image " + item.ResolvedURL
+	case item.TopImageURL != "":
+		return "would download image " + item.TopImageURL
+	case !isWebURL(item.ResolvedURL):
+		return "no image, since it isn't a web page"
+	default:
+		return "would look for a thumbnail, or take a screenshot of " + item.ResolvedURL
 	}
 }
 
-// Save a screenshot for a url.
-func saveScreenshot(url string, filename string) bool {
-	if outputLogs {
-		fmt.Printf("Saving screenshot (%s) for %s\n", filename, url)
+// Save either a remote image or screenshot for an item
+func saveImageForItem(b *browser, item ResultItem, filename string) bool {
+	// If the item itself is an image, save it.
+	if item.HasImage == 2 && saveRemoteImage(item.ResolvedURL, filename) {
+		return true
 	}
 
-	// Start an instance of Chrome.
-	ctx, cancel := chromedp.NewContext(context.Background())
-	defer cancel()
+	// Pocket already picked out the best image for the page, so try that next.
+	if item.TopImageURL != "" && saveRemoteImage(item.TopImageURL, filename) {
+		return true
+	}
 
-	// Start an image buffer and take a screenshot.
-	var imageBuf []byte
-	if err := chromedp.Run(ctx, chromeTakeScreenshot(url, &imageBuf)); err != nil {
-		if outputLogs {
-			fmt.Printf("Could not take screenshot for %s \n", filename)
-		}
+	// See if any of our resolvers can find a thumbnail for it.
+	if src := resolveThumbnail(item); src != "" && saveRemoteImage(src, filename) {
+		return true
+	}
+
+	// Chrome can only screenshot web pages, so leave anything else without an image.
+	if !isWebURL(item.ResolvedURL) {
+		slog.Debug("Not taking screenshot of non-web url", "url", item.ResolvedURL)
 		return false
 	}
 
-	// Write our image to the local filesystem.
-	if err := ioutil.WriteFile(filename, imageBuf, 0o644); err != nil {
-		if outputLogs {
-			fmt.Printf("Could not write screenshot for %s \n", filename)
-		}
+	// If we didn't save an image, then fall back to a screenshot of it.
+	return saveScreenshot(b, item.ResolvedURL, filename)
+}
+
+// Check whether a url is one we can load as a web page, rather than something
+// like a mailto: or file: url.
+func isWebURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
 		return false
 	}
+	scheme := strings.ToLower(u.Scheme)
+	return (scheme == "http" || scheme == "https") && u.Host != ""
+}
+
+// Work out what kind of content an item is.
+func itemType(item ResultItem) string {
+	// For the pocket api, hasImage/hasVideo gets set as 2 if that is the content type.
+	if item.HasImage == 2 {
+		return "image"
+	} else if item.HasVideo == 2 {
+		return "video"
+	}
 
-	return true
+	// Pocket doesn't flag PDFs, so go by the url.
+	if u, err := url.Parse(item.ResolvedURL); err == nil && strings.HasSuffix(strings.ToLower(u.Path), ".pdf") {
+		return "pdf"
+	}
+
+	// Anything Pocket doesn't think is an article is just a link.
+	if item.IsArticle == 0 {
+		return "link"
+	}
+
+	return "article"
 }
 
-// Save a remote image to our local filesystem.
-func saveRemoteImage(src, filename string) bool {
-	if outputLogs {
-		fmt.Printf("Saving image (%s) for %s\n", filename, src)
+// Estimate how many minutes it takes to read a number of words, rounding up.
+// Items Pocket hasn't counted the words of yet take 0 minutes, rather than guessing.
+func readingTime(words int) int {
+	if words <= 0 {
+		return 0
 	}
-	// Start our http request.
-	resp, err := http.Get(src)
+	return (words + opts.WordsPerMinute - 1) / opts.WordsPerMinute
+}
+
+// Convert a UNIX timestamp from Pocket into a time, leaving it as the zero
+// time if Pocket didn't give us one.
+func unixTime(timestamp int64) time.Time {
+	if timestamp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(timestamp, 0).UTC()
+}
+
+// Get the names of an item's tags, which are the keys of its tags map, in alphabetical order.
+func tagNames(item ResultItem) []string {
+	tags := []string{}
+	for tag := range item.Tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Get and process all our items from Pocket, saving images and PDFs for them
+// with saveImages. Cancelling the context stops us partway through, even in
+// the middle of a screenshot.
+func pocketItems(ctx context.Context, saveImages bool) ([]Item, error) {
+	// Retrieve a list of items from the API.
+	results, err := retrievePocketItems(ctx, 0, opts.State)
 	if err != nil {
-		if outputLogs {
-			fmt.Printf("Request failed for %s \n", src)
+		return nil, err
+	}
+
+	return processItems(ctx, results, saveImages)
+}
+
+// Process all the items in our results, skipping any that have been deleted.
+// Without saveImages, items only get the images and PDFs we already have, even
+// with -screenshots or -pdf. If the context is cancelled, we stop between items
+// and return its error.
+func processItems(ctx context.Context, results Result, saveImages bool) ([]Item, error) {
+	// Build up our items before doing any of the slow image work, so we can
+	// sort and limit them first. Keep the results they came from for that work.
+	items := []Item{}
+	sources := map[int]ResultItem{}
+	unresolved := 0
+	addedAfter, addedBefore, _ := addedRange(opts, time.Now())
+	for _, result := range results.List {
+		if result.Status == statusDeleted || !addedBetween(unixTime(result.TimeAdded), addedAfter, addedBefore) {
+			continue
 		}
-		return false
+
+		// Items Pocket hasn't resolved yet only have the url they were saved
+		// with, so we'd just get a poor item and a screenshot of a redirect.
+		if isUnresolved(result) {
+			unresolved++
+			if opts.SkipUnresolved {
+				continue
+			}
+		}
+
+		item, source := newItem(result)
+		items = append(items, item)
+		sources[item.ID] = source
 	}
-	defer resp.Body.Close()
+	sortItems(items)
 
-	// Make sure we got a valid response.
-	if resp.StatusCode != 200 {
-		if outputLogs {
-			fmt.Printf("Did not get 200 status for request %s \n", src)
+	// Only keep as many items as we've been asked for.
+	if opts.Limit > 0 && len(items) > opts.Limit {
+		items = items[:opts.Limit]
+	}
+
+	// Keep track of how long the slow work takes, for -verbose.
+	start := time.Now()
+	before := snapshotStats()
+
+	// Share a single browser between all our screenshots, and shut it down when we're done.
+	b := &browser{parent: ctx}
+	defer b.close()
+
+	// Only the image and PDF work is slow enough to be worth showing progress for.
+	saveShots, savePDFs := saveImages && opts.Screenshots, saveImages && opts.PDF
+	var prog *progress
+	if (saveShots || savePDFs) && !opts.DryRun {
+		prog = newProgress(len(items))
+	}
+
+	// Start up a pool of workers to save images for our items in parallel,
+	// as many as can do slow work at once unless we've been told otherwise.
+	// Each works on its own item in the slice, so they don't get in each other's way.
+	workers := opts.Workers
+	if workers == 0 {
+		workers = opts.Concurrency
+	}
+	var wg sync.WaitGroup
+	queue := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if ctx.Err() != nil {
+					continue
+				}
+				if prog != nil {
+					prog.next(items[i])
+				}
+				itemStart := time.Now()
+				if source := sources[items[i].ID]; !isUnresolved(source) {
+					saveItemImages(ctx, b, source, &items[i], saveShots)
+					saveItemPDF(ctx, b, &items[i], savePDFs)
+				}
+				logVerbose("Processed item", "id", items[i].ID, "duration", time.Since(itemStart).Round(time.Millisecond))
+			}
+		}()
+	}
+
+	// Hand each of our items off to the workers, and wait for them to finish.
+	// Ones we've failed to save images for before go first, so they get retried
+	// before anything else has a chance to go wrong.
+	var retries, rest []int
+	for i := range items {
+		if _, failed := lookupFailure(imageKey(sources[items[i].ID])); failed {
+			retries = append(retries, i)
+		} else {
+			rest = append(rest, i)
 		}
-		return false
 	}
+	for _, i := range append(retries, rest...) {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	if err := saveValidators(); err != nil {
+		slog.Warn("Could not save image validators", "error", err)
+	}
+	if err := saveFailures(); err != nil {
+		slog.Warn("Could not save image failures", "error", err)
+	}
+	logStatsSince(before, len(items), unresolved, start)
+	if unresolved > 0 {
+		slog.Info("Some items aren't resolved by Pocket yet, so they'll get images on a later run", "unresolved", unresolved, "skipped", opts.SkipUnresolved)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// Get the order to ask Pocket for items in, leaving anything it can't sort
+// by as newest first for us to sort ourselves.
+func pocketSort() string {
+	if opts.Sort == "oldest" {
+		return "oldest"
+	}
+	return "newest"
+}
+
+// Sort our items in the order chosen with -sort.
+func sortItems(items []Item) {
+	switch opts.Sort {
+	case "title":
+		sort.SliceStable(items, func(i, j int) bool {
+			return strings.ToLower(items[i].Title) < strings.ToLower(items[j].Title)
+		})
+	case "site":
+		sort.SliceStable(items, func(i, j int) bool {
+			return itemSite(items[i]) < itemSite(items[j])
+		})
+	default:
+		// Pocket already sorted them, so stick to its order.
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].SortID < items[j].SortID
+		})
+	}
+}
 
-	// Create a file on our filesystem.
-	file, err := os.Create(filename)
+// Get the site an item is from, its url's host without any www.
+func itemSite(item Item) string {
+	u, err := url.Parse(item.URL)
 	if err != nil {
-		if outputLogs {
-			fmt.Printf("Could not create file %s \n", filename)
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// Build an item from a Pocket result, without its images. The result is
+// returned with its resolved url filled in, if Pocket didn't have one.
+func newItem(item ResultItem) (Item, ResultItem) {
+	// Use the resolved title, but fallback to the given.
+	title := item.ResolvedTitle
+	if item.ResolvedTitle == "" {
+		title = item.GivenTitle
+	}
+
+	// Make sure we have a url, and a clean one. Also set it as the resolved url,
+	// so we don't need to check again and screenshot the same one.
+	url := normalizeURL(firstNonEmpty(item.ResolvedURL, item.GivenURL))
+	item.ResolvedURL = url
+
+	return Item{
+		ID:        item.ItemID,
+		Title:     title,
+		URL:       url,
+		Excerpt:   item.Excerpt,
+		Type:      itemType(item),
+		SortID:    item.SortID,
+		WordCount: item.WordCount,
+		Favorite:  item.Favorite == 1,
+		Tags:      tagNames(item),
+
+		ReadingTimeMinutes: readingTime(item.WordCount),
+
+		TimeAdded:   unixTime(item.TimeAdded),
+		TimeUpdated: unixTime(item.TimeUpdated),
+	}, item
+}
+
+// Save an image and thumbnail for an item with saveShots if we need to, and
+// set their urls on it if we have them.
+func saveItemImages(ctx context.Context, b *browser, source ResultItem, item *Item, saveShots bool) {
+	slog.Debug("Processing item", "id", item.ID, "title", item.Title, "url", item.URL)
+
+	// Save our screenshots & images in the images dir of the profile we're
+	// processing items for, named by their key. Only one worker saves images
+	// under a key at a time, since items can share them.
+	profile := siteFrom(ctx).profile
+	key := imageKey(source)
+	defer lockImage(key)()
+	name := key + "." + formatExtensions[opts.Format]
+	filename := filepath.Join(profilePath(profile, imagesDir), name)
+
+	// Check to see if we have a file for the image. With -revalidate, download
+	// it again if its source has changed, which means making a new thumbnail too.
+	imageSaved := fileExists(filename)
+	imageRefreshed := false
+	if saveShots && opts.Revalidate && !opts.DryRun && imageSaved {
+		imageRefreshed = revalidateImage(filename)
+	}
+
+	// Keep track of what happened to the item's image, for our logs.
+	outcome := "skipped"
+	if imageRefreshed {
+		outcome = "refreshed"
+	} else if imageSaved {
+		outcome = "cached"
+	}
+
+	// With -dry-run, just say what we'd do instead.
+	if saveShots && opts.DryRun {
+		fmt.Printf("item %d: %s\n", item.ID, plannedImage(source, imageSaved))
+	}
+
+	// If screenshot generation is enabled, check to see if we can save the image.
+	// Items we've failed on before are retried with backoff, until we give up on them.
+	if saveShots && !opts.DryRun && !imageSaved && shouldAttemptImage(key) {
+		imageSaved = saveImageForItem(b, source, filename)
+		outcome = resultLabel(imageSaved)
+
+		// Being stopped partway through isn't the item's fault, so don't count it.
+		if ctx.Err() == nil {
+			recordImageAttempt(key, imageSaved)
 		}
-		return false
 	}
-	defer file.Close()
+	// Only set the filename if the image is saved.
+	if imageSaved {
+		item.Image = itemImageURL(profile, name, filename)
+	}
 
-	// Write the remote image to our local file.
-	_, err = io.Copy(file, resp.Body)
+	// Keep a smaller copy of the image alongside it for thumbnails.
+	thumbName := key + "_thumb.png"
+	thumbFilename := filepath.Join(profilePath(profile, imagesDir), thumbName)
+	thumbSaved := imageSaved && !imageRefreshed && fileExists(thumbFilename)
+	if saveShots && !opts.DryRun && imageSaved && !thumbSaved {
+		thumbSaved = saveThumbnail(filename, thumbFilename)
+	}
+	if thumbSaved {
+		item.Thumbnail = itemImageURL(profile, thumbName, thumbFilename)
+	}
+
+	slog.Debug("Processed item", "id", item.ID, "url", item.URL, "outcome", outcome)
+}
+
+// Handle the API url to return a single item from our cache, by its ID.
+func handleItem(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.Atoi(req.PathValue("id"))
 	if err != nil {
-		if outputLogs {
-			fmt.Printf("Could not write file %s \n", filename)
-		}
-		return false
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
 	}
 
-	return true
+	item, ok, err := readCachedItem(siteFrom(req.Context()).profile, id)
+	if err != nil {
+		slog.Error("Failed reading cache", "error", err)
+		http.Error(w, "Failed reading cache", http.StatusInternalServerError)
+		return
+	} else if !ok {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+
+	output, err := json.Marshal(item)
+	if err != nil {
+		slog.Error("Failed marshaling JSON", "error", err)
+		http.Error(w, "Failed marshaling JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(output)
 }
 
-// Save either a remote image or screenshot for an item
-func saveImageForItem(item ResultItem, filename string) bool {
-	// If the item does have an image, attempt to process it.
-	if item.HasImage != 0 {
-		// Loop through all attached images and grab the source, width, and height.
-		for _, v := range item.Images {
-			source := v["src"].(string)
-
-			// Grab the youtube thumbnail if it is in the images list.
-			// @todo add more of these?
-			if strings.Contains(source, "i.ytimg.com") || strings.Contains(source, "img.youtube.com") {
-				return saveRemoteImage(source, filename)
-			}
+// Handle our cached list when it's stored in SQLite, rather than as a file,
+// filtering and paging it like /api/items but in the database.
+func handleDBItems(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	// Bad paging is the request's fault, so say so before querying.
+	limit, offset, err := pageBounds(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, total, err := queryDBItems(siteFrom(req.Context()).profile, query)
+	if err != nil {
+		slog.Error("Failed querying items", "error", err)
+		http.Error(w, "Failed querying items", http.StatusInternalServerError)
+		return
+	}
+
+	body := newCachedItems(items, time.Now())
+	if wantsPage(query) {
+		body = itemsPage{
+			Total:   total,
+			Offset:  offset,
+			Limit:   limit,
+			HasMore: offset+len(items) < total,
+			Items:   items,
 		}
-	} else if item.HasImage == 2 {
-		// If the item itself is an image, save it.
-		return saveRemoteImage(item.ResolvedURL, filename)
 	}
 
-	// If we didn't save an image, then save the screenshot of it.
-	return saveScreenshot(item.ResolvedURL, filename)
+	output, err := json.Marshal(body)
+	if err != nil {
+		slog.Error("Failed marshaling JSON", "error", err)
+		http.Error(w, "Failed marshaling JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(output)
 }
 
-// Get and process all our items from Pocket.
-func pocketItems() []Item {
-	// Retrieve a list of items from the API.
-	results := retrievePocketItems()
+// Work out the name an item's images are saved under. That's its ID, or with
+// -dedupe, a hash of its url so items saved from the same url share images.
+func imageKey(item ResultItem) string {
+	if opts.Dedupe {
+		return urlHash(item)
+	}
+	return strconv.Itoa(item.ItemID)
+}
 
-	// Set up a slice to contain all our processed items.
-	items := []Item{}
+// Hash an item's url into a short, filename safe key.
+func urlHash(item ResultItem) string {
+	sum := sha256.Sum256([]byte(normalizeURL(firstNonEmpty(item.ResolvedURL, item.GivenURL))))
+	return hex.EncodeToString(sum[:8])
+}
 
-	// Start looping through our items to process them.
-	for _, item := range results.List {
-		// Use the resolved title, but fallback to the given.
-		title := item.ResolvedTitle
-		if item.ResolvedTitle == "" {
-			title = item.GivenTitle
-		}
+// Locks for each image key currently being worked on.
+var imageLocks sync.Map
 
-		// Make sure we have a url.
-		url := item.ResolvedURL
-		if url == "" {
-			url = item.GivenURL
+// Lock an image key so no one else saves images under it, returning the func to unlock it.
+func lockImage(key string) func() {
+	lock, _ := imageLocks.LoadOrStore(key, &sync.Mutex{})
+	mu := lock.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
 
-			// Also set the resolved url so we don't need to check again.
-			item.ResolvedURL = url
-		}
+// Handle the API url to return our live JSON output.
+func handleItems(w http.ResponseWriter, req *http.Request) {
+	// There's no point asking Pocket for anything without our credentials.
+	s := siteFrom(req.Context())
+	if s.key == "" || s.token == "" {
+		http.Error(w, "Pocket credentials are not configured", http.StatusServiceUnavailable)
+		return
+	}
 
-		if outputLogs {
-			fmt.Printf("Processing %s (%s) \n", title, url)
-		}
+	// Get our items, which are only fetched from Pocket once they're out of date.
+	items, err := s.live.get()
+	if err != nil {
+		slog.Error("Failed retrieving items", "error", err)
+		http.Error(w, "Failed retrieving items", http.StatusInternalServerError)
+		return
+	}
 
-		// For the pocket api, hasImage/hasVideo gets set as 2 if that is the content type.
-		contentType := "article"
-		if item.HasImage == 2 {
-			contentType = "image"
-		} else if item.HasVideo == 2 {
-			contentType = "video"
+	// Only keep the items that were asked for, and if asked, only a page of them.
+	query := req.URL.Query()
+	items = filterItems(items, query)
+	var body interface{} = items
+	if wantsPage(query) {
+		page, err := paginateItems(items, query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
+		body = page
+	}
 
-		// Save our screenshots & images in our images dir, with the ID as the filename.
-		filename := fmt.Sprintf("images/%d.png", item.ItemID)
+	// Create our JSON output.
+	output, err := json.Marshal(body)
+	if err != nil {
+		slog.Error("Failed marshaling JSON", "error", err)
+		http.Error(w, "Failed marshaling JSON", http.StatusInternalServerError)
+		return
+	}
 
-		// Check to see if we have a file for the image.
-		imageSaved := fileExists(filename)
+	// Send back our headers and JSON.
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(output)
+}
 
-		// If screenshot generation is enabled, check to see if we can save the image.
-		if generateScreenshots && !imageSaved {
-			imageSaved = saveImageForItem(item, filename)
-		}
-		// Only set the filename if the image is saved.
-		publicFilename := ""
-		if imageSaved {
-			publicFilename = fmt.Sprintf("http://localhost:4000/%s", filename)
-		}
+// What happened the last time we fetched live items from Pocket, for health checks.
+var lastFetch struct {
+	sync.Mutex
+	at  time.Time
+	err error
+}
 
-		i := Item{
-			ID:      item.ItemID,
-			Title:   title,
-			URL:     url,
-			Excerpt: item.Excerpt,
-			Type:    contentType,
-			SortID:  item.SortID,
-			Image:   publicFilename,
-		}
+// Record the outcome of a live fetch from Pocket.
+func recordFetch(err error) {
+	lastFetch.Lock()
+	defer lastFetch.Unlock()
+	lastFetch.at = time.Now()
+	lastFetch.err = err
+}
+
+// Struct for our health check response.
+type health struct {
+	Status      string     `json:"status"`
+	CachedItems int        `json:"cached_items"`
+	LastFetch   *time.Time `json:"last_fetch,omitempty"`
+	LastFetchOK *bool      `json:"last_fetch_ok,omitempty"`
+}
+
+// Handle the health check url, which reports on what we already know
+// without asking Pocket for anything or taking any screenshots.
+func handleHealth(w http.ResponseWriter, req *http.Request) {
+	h := health{Status: "ok"}
 
-		items = append(items, i)
+	// Count what's in our cache.
+	if items, err := readCachedItems(opts.Profile); err == nil {
+		h.CachedItems = len(items)
 	}
 
-	sort.Slice(items, func(i, j int) bool {
-		return items[i].SortID < items[j].SortID
-	})
+	// Include how our last live fetch went, if we've had one.
+	lastFetch.Lock()
+	if !lastFetch.at.IsZero() {
+		at, ok := lastFetch.at, lastFetch.err == nil
+		h.LastFetch, h.LastFetchOK = &at, &ok
+	}
+	lastFetch.Unlock()
 
-	return items
+	output, err := json.Marshal(h)
+	if err != nil {
+		http.Error(w, "Failed marshaling JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(output)
 }
 
+// Run our webserver. Anything that goes wrong while handling a request is
+// logged and returned as an error response, so the server stays up.
 func serve() {
-	// Handle the base url to return our JSON output
-	// http.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
-	// 	// Toggle our screenshot generation flag to false,
-	// 	// as we don't want to slow the response down.
-	// 	generateScreenshots = false
+	// We can still serve our cache without credentials, just not live items.
+	if err := checkCredentials(true); err != nil {
+		slog.Warn("Live items at /api/items won't be available", "error", err)
+	}
 
-	// 	// Get our pocket itet and process all our items from Pocket.ems.
-	// 	items := pocketItems()
-	// 	// Retrieve a list of items from the API.
+	// Our live fetches and background refreshes run until we shut down.
+	work, stopWork := context.WithCancel(context.Background())
+	liveItems.ctx = work
+	refreshing.ctx = work
 
-	// 	// Create our JSON output.
-	// 	// Start looping through our items to process them.
-	// 	output, err := json.Marshal(items)
-	// 	if err != nil {
-	// 		log.Fatal("Failed marshal JSON")
-	// 		log.Fatal(err)
-	// 	}
+	// The API url returns a live list of items, while the base url serves our
+	// cached list. Health, metrics, and refreshing are for the whole server.
+	siteRoutes(http.DefaultServeMux, opts.Profile)
+	http.HandleFunc("/healthz", handleHealth)
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("POST /api/refresh", handleRefresh)
 
-	// 	// Send back our headers.
-	// 	w.Header().Set("Content-Type", "application/json")
-	// 	w.WriteHeader(http.StatusCreated)
+	// Every profile is also served under its name, which is where the urls of
+	// their images point.
+	mountProfiles(work)
 
-	// 	// Send our JSON.
-	// 	fmt.Fprint(w, string(output))
-	// })
+	// Serve it on our address, in the background so we can listen for a signal to stop.
+	server := &http.Server{Addr: opts.Addr, Handler: withCORS(withGzip(http.DefaultServeMux))}
+	go func() {
+		slog.Info("Starting server", "url", baseURL())
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("Failed starting server", "error", err)
+		}
+	}()
 
-	http.Handle("/", http.FileServer(http.Dir("./cache")))
+	// Keep our cache up to date in the background, if we've been asked to.
+	if opts.Refresh > 0 && checkCredentials(true) == nil {
+		go refreshEvery(work, opts.Refresh)
+	}
 
-	// The screenshots folder will serve our static folder of images.
-	http.Handle("/images/", http.StripPrefix("/images/", http.FileServer(http.Dir("./images"))))
+	// Wait until we're told to stop, then abort any fetching and screenshots in progress.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	stopWork()
 
-	// Serve it on port 4000.
-	fmt.Println("Starting server at http://localhost:4000")
-	if err := http.ListenAndServe("localhost:4000", nil); err != nil {
-		log.Fatal(err)
+	// Give any outstanding requests a chance to finish before we exit.
+	slog.Info("Shutting down gracefully")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Failed shutting down gracefully", "error", err)
 	}
 }
 
+// Get all our items and write them to the cache. This is a one-shot
+// command, so any error along the way is fatal.
 func get() {
-	items := pocketItems()
-	f, err := os.Create("cache/all.json")
-	if err != nil {
-		log.Fatal("Failed creating cache file")
-		log.Fatal(err)
+	if err := checkCredentials(true); err != nil {
+		exitWithHelp(err)
 	}
-	defer f.Close()
 
-	data, err := json.MarshalIndent(items, "", "  ")
-	if err != nil {
-		log.Fatal("Failed marshaling JSON")
-		log.Fatal(err)
+	// Stop cleanly, without writing anything, if we're interrupted.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := refresh(ctx); err != nil {
+		fatal("Failed getting items", "error", err)
 	}
+}
 
-	_, err = f.WriteString(string(data))
+// Get our items from Pocket and write them to the cache, along with any other
+// output we've been asked for.
+func refresh(ctx context.Context) error {
+	// Either sync the changes since our last run, or get everything.
+	var (
+		items []Item
+		since int
+		err   error
+	)
+	if opts.Since {
+		items, since, err = syncItems(ctx)
+	} else {
+		items, err = pocketItems(ctx, true)
+	}
 	if err != nil {
-		log.Fatal("Failed writing cache file")
-		log.Fatal(err)
+		return fmt.Errorf("retrieving items: %w", err)
+	}
+
+	if opts.DryRun {
+		fmt.Printf("Would write %d items\n", len(items))
+		return nil
+	}
+
+	if err := writeCachedItems(items); err != nil {
+		return fmt.Errorf("writing cache file: %w", err)
+	}
+
+	if err := writeOutput(items); err != nil {
+		return fmt.Errorf("writing %s output: %w", opts.Output, err)
+	}
+
+	// Only remember when we synced once our cache is up to date.
+	if opts.Since {
+		state := syncState{Since: since, LastRun: time.Now().UTC(), ItemCount: len(items)}
+		if err := saveState(state); err != nil {
+			return fmt.Errorf("writing since file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Refresh our cache every interval in the background, until the context is
+// cancelled, which also stops any refresh in progress.
+func refreshEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Skip this one if a refresh we were asked for is still going.
+			if !refreshing.TryLock() {
+				slog.Info("Skipping scheduled refresh, one is already running")
+				continue
+			}
+			logRefresh(ctx)
+			refreshing.Unlock()
+		}
+	}
+}
+
+// Refresh our cache in the background, logging how it went. Callers must hold
+// the refreshing lock.
+func logRefresh(ctx context.Context) {
+	start := time.Now()
+	if err := refresh(ctx); err != nil {
+		slog.Error("Failed refreshing cache", "error", err)
+		return
 	}
+	slog.Info("Refreshed cache", "duration", time.Since(start))
+}
+
+// Held while the server is refreshing its cache, so only one refresh runs at
+// a time, along with the context refreshes run in until we shut down.
+var refreshing struct {
+	sync.Mutex
+	ctx context.Context
+}
+
+// Handle a request to refresh our cache now, which has to carry our refresh
+// token. The refresh runs in the background, so we respond as soon as it starts.
+func handleRefresh(w http.ResponseWriter, req *http.Request) {
+	token := refreshToken()
+	if token == "" {
+		http.Error(w, "Refreshing isn't enabled, start the server with -refresh-token", http.StatusNotFound)
+		return
+	}
+
+	given, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="pocket"`)
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := checkCredentials(true); err != nil {
+		http.Error(w, "Pocket credentials aren't set up", http.StatusServiceUnavailable)
+		return
+	}
+
+	if !refreshing.TryLock() {
+		http.Error(w, "A refresh is already running", http.StatusConflict)
+		return
+	}
+	go func() {
+		defer refreshing.Unlock()
+		logRefresh(refreshing.ctx)
+	}()
+
+	slog.Info("Started refresh", "remote_addr", req.RemoteAddr)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"status":"refreshing"}`))
+}
+
+// Get the token for /api/refresh, from the environment or -refresh-token.
+func refreshToken() string {
+	return firstNonEmpty(os.Getenv("POCKET_REFRESH_TOKEN"), opts.RefreshToken)
 }
 
 func main() {
-	// If we call it with the argument "get", then we want to just
-	// get all the items, otherwise we're going to be a webserver.
-	if len(os.Args) > 1 && os.Args[1] == "get" {
-		get()
-	} else {
-		// outputLogs = false
-		serve()
+	c, args := parseCommand(os.Args[1:])
+	if err := setupLogging(opts.LogLevel, opts.LogFormat, c.name); err != nil {
+		fatal(err.Error())
+	}
+	if err := opts.validate(); err != nil {
+		fatal(err.Error())
 	}
+	// Resolve our paths up front, so they don't depend on where we're run from later.
+	dir, err := filepath.Abs(opts.OutputDir)
+	if err != nil {
+		fatal("Failed resolving output directory", "dir", opts.OutputDir, "error", err)
+	}
+	opts.OutputDir = dir
+	if opts.SinceFile == "" {
+		opts.SinceFile = outputPath(stateFile)
+	}
+
+	remoteClient.Timeout = opts.ImageTimeout
+	workSlots = make(chan struct{}, opts.Concurrency)
+	if opts.MaxPageLoads > 0 {
+		pageLoadSlots = make(chan struct{}, opts.MaxPageLoads)
+	}
+	pocketClient.Timeout = opts.Timeout
+	if err := loadCredentials(c.name == "auth"); err != nil {
+		fatal(err.Error())
+	}
+
+	if opts.Format == "png" && opts.Quality != defaultQuality {
+		slog.Warn("-quality only applies to jpeg and webp screenshots, so it's ignored for png")
+	}
+	if opts.EmbedImages {
+		slog.Warn("Embedding images makes the JSON much larger, so only images up to -embed-max-size are embedded", "max_bytes", opts.EmbedMaxSize)
+	}
+
+	// Load our cookies up front, so a bad file stops us before any screenshots.
+	if opts.CookieFile != "" {
+		if cookies, err = loadCookies(opts.CookieFile); err != nil {
+			fatal("Failed loading cookies", "file", opts.CookieFile, "error", err)
+		}
+		slog.Debug("Loaded cookies", "file", opts.CookieFile, "count", len(cookies))
+	}
+
+	// Make sure we have somewhere to put our cache and images before doing anything with them.
+	if c.name != "auth" {
+		if err := ensureDirs(); err != nil {
+			fatal(err.Error())
+		}
+	}
+
+	c.run(args)
 }
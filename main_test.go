@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestResultUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    map[string]int
+	}{
+		{
+			name:    "empty list as an array",
+			payload: `{"status": 2, "complete": 1, "since": 1700000000, "list": []}`,
+			want:    map[string]int{},
+		},
+		{
+			name:    "list as an object",
+			payload: `{"status": 1, "complete": 1, "since": 1700000000, "list": {"123": {"item_id": "123", "given_url": "https://example.com"}, "456": {"item_id": "456"}}}`,
+			want:    map[string]int{"123": 123, "456": 456},
+		},
+		{
+			name:    "null list",
+			payload: `{"status": 2, "complete": 1, "since": 1700000000, "list": null}`,
+			want:    map[string]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r Result
+			if err := json.Unmarshal([]byte(tt.payload), &r); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+
+			if r.List == nil {
+				t.Fatal("List is nil, want an empty map")
+			}
+			if len(r.List) != len(tt.want) {
+				t.Fatalf("List has %d items, want %d", len(r.List), len(tt.want))
+			}
+			for id, itemID := range tt.want {
+				if got := r.List[id].ItemID; got != itemID {
+					t.Errorf("List[%q].ItemID = %d, want %d", id, got, itemID)
+				}
+			}
+
+			// The rest of the result should decode as usual, whatever form the list takes.
+			if r.Complete != 1 || r.Since != 1700000000 {
+				t.Errorf("Complete, Since = %d, %d, want 1, 1700000000", r.Complete, r.Since)
+			}
+		})
+	}
+}
+
+func TestItemType(t *testing.T) {
+	tests := []struct {
+		name string
+		item ResultItem
+		want string
+	}{
+		{"image", ResultItem{HasImage: 2, IsArticle: 1, ResolvedURL: "https://example.com/photo.jpg"}, "image"},
+		{"video", ResultItem{HasVideo: 2, IsArticle: 1, ResolvedURL: "https://example.com/watch"}, "video"},
+		{"image wins over video", ResultItem{HasImage: 2, HasVideo: 2}, "image"},
+		{"pdf", ResultItem{IsArticle: 1, ResolvedURL: "https://example.com/paper.pdf"}, "pdf"},
+		{"upper case pdf with a query string", ResultItem{ResolvedURL: "https://example.com/Paper.PDF?download=1#page=2"}, "pdf"},
+		{"pdf only in the query string", ResultItem{IsArticle: 1, ResolvedURL: "https://example.com/view?file=paper.pdf"}, "article"},
+		{"link", ResultItem{IsArticle: 0, ResolvedURL: "https://example.com/"}, "link"},
+		{"article", ResultItem{IsArticle: 1, HasImage: 1, HasVideo: 1, ResolvedURL: "https://example.com/post"}, "article"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := itemType(tt.item); got != tt.want {
+				t.Errorf("itemType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsWebURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com/post", true},
+		{"http://example.com", true},
+		{"HTTPS://Example.com/Post", true},
+		{"HtTp://example.com", true},
+		{"mailto:someone@example.com", false},
+		{"file:///etc/passwd", false},
+		{"data:text/html,<h1>hi</h1>", false},
+		{"javascript:alert(1)", false},
+		{"example.com/post", false},
+		{"//example.com/post", false},
+		{"https://", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isWebURL(tt.url); got != tt.want {
+			t.Errorf("isWebURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestScreenshotParamsQuality(t *testing.T) {
+	saved := opts
+	t.Cleanup(func() { opts = saved })
+
+	tests := []struct {
+		format  string
+		quality int
+		want    int64
+	}{
+		{"jpeg", 60, 60},
+		{"webp", 80, 80},
+		{"jpeg", defaultQuality, defaultQuality},
+		{"png", 60, 0},
+	}
+
+	for _, tt := range tests {
+		opts.Format, opts.Quality = tt.format, tt.quality
+		params := screenshotParams()
+
+		if string(params.Format) != tt.format {
+			t.Errorf("format %s: Format = %q, want %q", tt.format, params.Format, tt.format)
+		}
+		if params.Quality != tt.want {
+			t.Errorf("format %s with quality %d: Quality = %d, want %d", tt.format, tt.quality, params.Quality, tt.want)
+		}
+
+		// Leaving quality out for png means it's left out of the request to Chrome entirely.
+		data, err := json.Marshal(params)
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		var sent map[string]interface{}
+		json.Unmarshal(data, &sent)
+		if _, ok := sent["quality"]; ok != (tt.want != 0) {
+			t.Errorf("format %s: quality sent = %v, want %v", tt.format, ok, tt.want != 0)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Where we list the images we've saved, with -output manifest.
+var manifestFile = filepath.Join(cacheDir, "images.json")
+
+// What we know about an item's saved image, for anything that wants to know
+// what we've got without looking through our images.
+type manifestEntry struct {
+	File        string    `json:"file"`
+	Bytes       int64     `json:"bytes"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// Write out a manifest of our items' images, keyed by item ID. Items without
+// an image are left out.
+func writeManifest(items []Item) error {
+	manifest := map[string]manifestEntry{}
+	for _, item := range items {
+		if item.Image == "" {
+			continue
+		}
+
+		entry, err := newManifestEntry(path.Base(item.Image))
+		if err != nil {
+			slog.Warn("Could not add image to manifest", "id", item.ID, "error", err)
+			continue
+		}
+		manifest[strconv.Itoa(item.ID)] = entry
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(outputPath(manifestFile), data)
+}
+
+// Describe one of our saved images, reading its dimensions from its header.
+func newManifestEntry(name string) (manifestEntry, error) {
+	filename := filepath.Join(outputPath(imagesDir), name)
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return manifestEntry{}, err
+	}
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+
+	return manifestEntry{
+		File:        path.Join(imagesDir, name),
+		Bytes:       info.Size(),
+		Width:       config.Width,
+		Height:      config.Height,
+		GeneratedAt: info.ModTime().UTC(),
+	}, nil
+}
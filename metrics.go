@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics for anyone running us as a service, served at /metrics.
+var (
+	pocketRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pocket_requests_total",
+		Help: "Requests made to the Pocket API, by path and status code.",
+	}, []string{"path", "code"})
+
+	screenshots = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pocket_screenshots_total",
+		Help: "Screenshots taken of item pages, by whether they were saved or failed.",
+	}, []string{"result"})
+
+	screenshotDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pocket_screenshot_duration_seconds",
+		Help:    "How long screenshots took, whether or not they were saved.",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 8),
+	})
+
+	remoteImages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pocket_remote_images_total",
+		Help: "Remote images downloaded for items, by whether they were saved or failed.",
+	}, []string{"result"})
+)
+
+// Count a request to the Pocket API, labelled with its status code, or error
+// if it didn't get one.
+func countPocketRequest(req *http.Request, resp *http.Response, err error) {
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	pocketRequests.WithLabelValues(req.URL.Path, code).Inc()
+}
+
+// Turn whether something was saved into a result label.
+func resultLabel(saved bool) string {
+	if saved {
+		return "saved"
+	}
+	return "failed"
+}
+
+// Count a screenshot, and how long it took.
+func countScreenshot(saved bool, start time.Time) {
+	duration := time.Since(start)
+	screenshots.WithLabelValues(resultLabel(saved)).Inc()
+	screenshotDuration.Observe(duration.Seconds())
+
+	// Keep our own totals too, for -verbose.
+	stats.screenshots.Add(1)
+	stats.screenshotTime.Add(int64(duration))
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// How long browsers can use an image without checking back with us. Screenshots
+// rarely change once they're taken, and the ETag catches the ones that do.
+const imageMaxAge = 24 * 60 * 60
+
+// Wrap a file server for a directory to send caching headers, with an ETag
+// from each file's modification time and size. The file server then answers
+// If-None-Match and If-Modified-Since with a 304 for us.
+func withCaching(dir string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		filename := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+req.URL.Path)))
+		if info, err := os.Stat(filename); err == nil && info.Mode().IsRegular() {
+			w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+			w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(imageMaxAge))
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// Wrap a handler to send CORS headers for our allowed origins, and answer
+// preflight requests, so frontends served from elsewhere can use us.
+func withCORS(next http.Handler) http.Handler {
+	// Without any allowed origins, leave the browser's same-origin policy alone.
+	if opts.CORSOrigin == "" {
+		return next
+	}
+
+	origins := strings.Split(opts.CORSOrigin, ",")
+	for i := range origins {
+		origins[i] = strings.TrimSpace(origins[i])
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Allow everyone, or echo back the request's origin if it's one we allow.
+		if contains(origins, "*") {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Add("Vary", "Origin")
+			if origin := req.Header.Get("Origin"); contains(origins, origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+		}
+
+		// Answer preflight requests ourselves, as none of our handlers know about them.
+		if req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+			if headers := req.Header.Get("Access-Control-Request-Headers"); headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			w.Header().Set("Access-Control-Max-Age", "86400")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// Content types worth compressing. Images like PNG and JPEG are already
+// compressed, so they're left alone.
+var compressibleTypes = []string{
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/rss+xml",
+	"application/atom+xml",
+	"image/svg+xml",
+}
+
+// Check if a content type is worth compressing.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || contains(compressibleTypes, mediaType)
+}
+
+// Wrap a handler to gzip responses worth compressing, for clients that accept it.
+func withGzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gw := &gzipResponseWriter{
+			ResponseWriter: w,
+			accepts:        acceptsGzip(req),
+		}
+		defer gw.close()
+
+		next.ServeHTTP(gw, req)
+	})
+}
+
+// Check if a request says it accepts gzip encoded responses.
+func acceptsGzip(req *http.Request) bool {
+	for _, part := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		fields := strings.Split(part, ";")
+		if strings.TrimSpace(fields[0]) != "gzip" {
+			continue
+		}
+
+		// A quality of zero means the client specifically doesn't want it.
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); strings.HasPrefix(param, "q=") && err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// A response writer that decides whether to gzip the body once it knows the
+// response's status and content type.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	accepts     bool
+	wroteHeader bool
+	gz          *gzip.Writer
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+
+	h := g.Header()
+	if compressible(h.Get("Content-Type")) {
+		// Caches need to know the response depends on what the client accepts.
+		h.Add("Vary", "Accept-Encoding")
+
+		// Partial and empty responses, and anything already encoded, go out as-is.
+		if g.accepts && status == http.StatusOK && h.Get("Content-Encoding") == "" {
+			h.Set("Content-Encoding", "gzip")
+			h.Del("Content-Length")
+			g.gz = gzip.NewWriter(g.ResponseWriter)
+		}
+	}
+
+	g.ResponseWriter.WriteHeader(status)
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !g.wroteHeader {
+		// Sniff the content type like net/http would, so we know whether to compress.
+		if g.Header().Get("Content-Type") == "" {
+			g.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		g.WriteHeader(http.StatusOK)
+	}
+
+	if g.gz != nil {
+		return g.gz.Write(b)
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+// Finish off the compressed body, if we were compressing one.
+func (g *gzipResponseWriter) close() {
+	if g.gz != nil {
+		g.gz.Close()
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Query params that only track where a visit came from, which we strip with
+// -strip-tracking. Anything starting with utm_ is one too.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+	"mkt_tok": true,
+}
+
+// Check whether a query param is only there for tracking.
+func isTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "utm_") || trackingParams[name]
+}
+
+// Clean up a url saved to Pocket before we use it: trim it, give it a scheme
+// if it doesn't have one, and strip its tracking params with -strip-tracking.
+// Urls we can't make sense of are just trimmed.
+func normalizeURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return raw
+	}
+
+	// Without a scheme, a url like example.com/page parses as a path, and one
+	// like example.com:8080/page parses as an example.com scheme.
+	// A scheme-relative url like //example.com/page just needs one.
+	u, err := url.Parse(raw)
+	if err == nil && u.Scheme == "" && u.Host != "" {
+		u.Scheme = "https"
+	} else if err != nil || u.Scheme == "" || (u.Host == "" && strings.Contains(u.Scheme, ".")) {
+		if u, err = url.Parse("https://" + raw); err != nil {
+			return raw
+		}
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+
+	if opts.StripTracking && u.RawQuery != "" {
+		query := u.Query()
+		stripped := false
+		for name := range query {
+			if isTrackingParam(name) {
+				query.Del(name)
+				stripped = true
+			}
+		}
+		if stripped {
+			u.RawQuery = query.Encode()
+		}
+	}
+
+	return u.String()
+}
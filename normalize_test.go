@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	saved := opts
+	t.Cleanup(func() { opts = saved })
+	opts.StripTracking = true
+
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"", ""},
+		{"  https://example.com/page  ", "https://example.com/page"},
+		{"example.com/page", "https://example.com/page"},
+		{"example.com:8080/page", "https://example.com:8080/page"},
+		{"//example.com/x", "https://example.com/x"},
+		{"HTTPS://Example.COM/Page", "https://example.com/Page"},
+		{"http://example.com/?utm_source=feed&fbclid=abc&id=1", "http://example.com/?id=1"},
+		{"https://example.com/?utm_source=feed", "https://example.com/"},
+		{"mailto:someone@example.com", "mailto:someone@example.com"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeURL(tt.raw); got != tt.want {
+			t.Errorf("normalizeURL(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
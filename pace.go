@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Slots for pages we're loading in Chrome, set up once our options are parsed
+// if -max-page-loads caps them. They're nil otherwise, leaving -concurrency
+// as the only cap.
+var pageLoadSlots chan struct{}
+
+// When the next page load can start, so -page-delay spaces them out across
+// all our workers.
+var pageLoadPace struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// Wait until we're allowed to start loading another page, returning a function
+// to call once we're done with it. Cancelling the context stops us waiting.
+func startPageLoad(ctx context.Context) (func(), error) {
+	if pageLoadSlots != nil {
+		select {
+		case pageLoadSlots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	done := func() {
+		if pageLoadSlots != nil {
+			<-pageLoadSlots
+		}
+	}
+
+	if opts.PageDelay > 0 {
+		pageLoadPace.mu.Lock()
+		start := time.Now()
+		if pageLoadPace.next.After(start) {
+			start = pageLoadPace.next
+		}
+		pageLoadPace.next = start.Add(pageDelay())
+		pageLoadPace.mu.Unlock()
+
+		if err := sleepContext(ctx, time.Until(start)); err != nil {
+			done()
+			return nil, err
+		}
+	}
+
+	return done, nil
+}
+
+// Pick how long to wait before the page load after this one. Half of it is
+// -page-delay, and the rest is exponentially distributed jitter averaging the
+// other half, so loads don't fall into a pattern sites can spot.
+func pageDelay() time.Duration {
+	half := float64(opts.PageDelay) / 2
+	return time.Duration(half + rand.ExpFloat64()*half)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// Where we keep PDFs of our items, inside our cache so they're served along with it.
+const pdfSubdir = "pdf"
+
+var pdfDir = filepath.Join(cacheDir, pdfSubdir)
+
+// Save a PDF of an item's page with save if we don't have one yet, and set its
+// url on the item if we have one. PDFs go in the pdf dir of the profile we're
+// processing items for.
+func saveItemPDF(ctx context.Context, b *browser, item *Item, save bool) {
+	profile := siteFrom(ctx).profile
+	name := strconv.Itoa(item.ID) + ".pdf"
+	filename := filepath.Join(profilePath(profile, pdfDir), name)
+
+	pdfSaved := fileExists(filename)
+	if save && !pdfSaved && !isWebURL(item.URL) {
+		slog.Debug("Not saving PDF of non-web url", "url", item.URL)
+	} else if save && !pdfSaved && opts.DryRun {
+		fmt.Printf("item %d: would save PDF of %s\n", item.ID, item.URL)
+	} else if save && !pdfSaved {
+		pdfSaved = savePDF(b, item.URL, filename)
+	}
+	if pdfSaved {
+		item.PDF = fileURL(profile, path.Join(pdfSubdir, name))
+	}
+}
+
+// Print a url to a PDF, in a new tab of our browser, with the same timeout as
+// our screenshots.
+func savePDF(b *browser, url string, filename string) bool {
+	// Pace our page loads like screenshots do.
+	done, err := startPageLoad(b.parent)
+	if err != nil {
+		return false
+	}
+	defer done()
+	defer acquireSlot()()
+	slog.Debug("Saving PDF", "file", filename, "url", url)
+	start := time.Now()
+
+	ctx, cancel, err := b.newTab()
+	if err != nil {
+		slog.Error("Could not start Chrome", "file", filename, "error", err)
+		return false
+	}
+	defer cancel()
+
+	ctx, cancelTimeout := context.WithTimeout(ctx, opts.ScreenshotTimeout)
+	defer cancelTimeout()
+
+	// Chrome sends the PDF back base64 encoded, which PrintToPDF decodes for us.
+	var pdfBuf []byte
+	err = chromedp.Run(ctx,
+		emulateUserAgent(),
+		blockTrackers(),
+		injectCookies(url),
+		navigateAndWait(url),
+		dismissOverlays(),
+		chromedp.ActionFunc(func(ctx context.Context) (err error) {
+			pdfBuf, _, err = page.PrintToPDF().WithPrintBackground(true).Do(ctx)
+			return err
+		}),
+	)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			slog.Warn("Timed out saving PDF", "url", url, "timeout", opts.ScreenshotTimeout)
+		} else {
+			slog.Warn("Could not save PDF", "url", url, "error", err, "duration", time.Since(start))
+		}
+		return false
+	}
+
+	if err := writeFileAtomic(filename, pdfBuf); err != nil {
+		slog.Error("Could not write PDF", "file", filename, "error", err)
+		return false
+	}
+
+	slog.Debug("Saved PDF", "file", filename, "url", url, "duration", time.Since(start))
+	return true
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// How often, in percent, to log our progress when nobody is watching the terminal.
+const progressStep = 10
+
+// Keeps track of how far through our items we are, so long runs show how much is left.
+type progress struct {
+	mu      sync.Mutex
+	total   int
+	current int
+	logged  int
+	tty     bool
+}
+
+// Start tracking progress through the given number of items.
+func newProgress(total int) *progress {
+	return &progress{total: total, tty: isTerminal(os.Stderr)}
+}
+
+// Report that we've started on the next item. On a terminal that's a counter
+// on every item (unless we're only logging warnings), otherwise it's a log
+// line every progressStep percent.
+func (p *progress) next(item Item) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.current++
+	if p.tty {
+		if logLevel.Level() <= slog.LevelInfo {
+			fmt.Fprintf(os.Stderr, "[%d/%d] Processing %s\n", p.current, p.total, item.Title)
+		}
+		return
+	}
+
+	percent := p.current * 100 / p.total
+	if percent/progressStep > p.logged/progressStep {
+		p.logged = percent
+		slog.Info("Progress", "current", p.current, "total", p.total, "percent", percent)
+	}
+}
+
+// Check whether a file is an interactive terminal, rather than a pipe or a log file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
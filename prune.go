@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Delete images for items that are no longer in Pocket, which otherwise
+// build up forever as items get archived or deleted.
+func prune() {
+	if err := checkCredentials(true); err != nil {
+		exitWithHelp(err)
+	}
+
+	// Only a tag's items would count as current, so every other image would go.
+	if opts.Tag != "" {
+		fatal("prune can't be used with -tag, it would delete the images of every item without the tag")
+	}
+	if opts.FavoritesOnly {
+		fatal("prune can't be used with -favorites-only, it would delete the images of every item that isn't a favorite")
+	}
+	if opts.Search != "" {
+		fatal("prune can't be used with -search, it would delete the images of every item that doesn't match")
+	}
+
+	results, err := retrievePocketItems(context.Background(), 0, opts.State)
+	if err != nil {
+		fatal("Failed retrieving items", "error", err)
+	}
+
+	// Images can be named by either an item's ID or its url, depending on -dedupe.
+	current := map[string]bool{}
+	for _, item := range results.List {
+		current[strconv.Itoa(item.ItemID)] = true
+		current[urlHash(item)] = true
+	}
+
+	files, err := ioutil.ReadDir(outputPath(imagesDir))
+	if err != nil {
+		fatal("Failed reading images", "dir", imagesDir, "error", err)
+	}
+
+	removed := 0
+	for _, file := range files {
+		key, ok := imageFileKey(file.Name())
+		if !ok || file.IsDir() || current[key] {
+			continue
+		}
+
+		filename := filepath.Join(outputPath(imagesDir), file.Name())
+		if opts.DryRun {
+			fmt.Printf("Would delete %s\n", filename)
+			removed++
+			continue
+		}
+
+		if err := os.Remove(filename); err != nil {
+			slog.Error("Could not delete image", "file", filename, "error", err)
+			continue
+		}
+		slog.Info("Deleted image", "file", filename)
+		removed++
+	}
+
+	if opts.DryRun {
+		fmt.Printf("Would delete %d images, keeping %d items\n", removed, len(results.List))
+	} else {
+		slog.Info("Pruned images", "deleted", removed, "kept_items", len(results.List))
+	}
+}
+
+// Work out the key an image was saved under from its filename, which is either
+// "<key>.<ext>" or "<key>_thumb.png". Keys are either an item ID or a url hash,
+// anything else isn't one of ours.
+func imageFileKey(name string) (string, bool) {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	name = strings.TrimSuffix(name, "_thumb")
+
+	if id, err := strconv.Atoi(name); err == nil && id > 0 {
+		return name, true
+	}
+	if b, err := hex.DecodeString(name); err == nil && len(b) == 8 {
+		return name, true
+	}
+	return "", false
+}
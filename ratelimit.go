@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Struct for the rate limits Pocket reports with each response, both for our
+// user (access token) and our app (consumer key). Resets are in seconds, and
+// anything Pocket didn't tell us about is -1.
+type RateLimit struct {
+	UserLimit     int
+	UserRemaining int
+	UserReset     int
+	KeyLimit      int
+	KeyRemaining  int
+	KeyReset      int
+}
+
+// Parse the rate limits from the headers of a Pocket response.
+func parseRateLimit(header http.Header) RateLimit {
+	value := func(name string) int {
+		v, err := strconv.Atoi(header.Get(name))
+		if err != nil {
+			return -1
+		}
+		return v
+	}
+
+	return RateLimit{
+		UserLimit:     value("X-Limit-User-Limit"),
+		UserRemaining: value("X-Limit-User-Remaining"),
+		UserReset:     value("X-Limit-User-Reset"),
+		KeyLimit:      value("X-Limit-Key-Limit"),
+		KeyRemaining:  value("X-Limit-Key-Remaining"),
+		KeyReset:      value("X-Limit-Key-Reset"),
+	}
+}
+
+// Get how long we need to wait before making another request, which is
+// until the reset window of any limit we've run out of.
+func (r RateLimit) wait() time.Duration {
+	var wait time.Duration
+	if r.UserRemaining == 0 && r.UserReset > 0 {
+		wait = time.Duration(r.UserReset) * time.Second
+	}
+	if r.KeyRemaining == 0 && time.Duration(r.KeyReset)*time.Second > wait {
+		wait = time.Duration(r.KeyReset) * time.Second
+	}
+	return wait
+}
+
+func (r RateLimit) String() string {
+	return fmt.Sprintf("user %d/%d (resets in %ds), key %d/%d (resets in %ds)",
+		r.UserRemaining, r.UserLimit, r.UserReset, r.KeyRemaining, r.KeyLimit, r.KeyReset)
+}
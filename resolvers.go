@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// The most of a page we'll read looking for its meta tags, which live in the <head>.
+const maxPageSize = 1 << 20
+
+// A thumbnail resolver works out an image url for an item without needing
+// a screenshot, returning an empty string if it can't find one.
+type thumbnailResolver func(item ResultItem) string
+
+// Our resolvers, in the order we try them. Cheaper and more specific ones go first.
+var thumbnailResolvers = []thumbnailResolver{
+	youtubeThumbnail,
+	vimeoThumbnail,
+	metaThumbnail,
+	largestImage,
+}
+
+// Find a thumbnail image url for an item from the first resolver that has one.
+func resolveThumbnail(item ResultItem) string {
+	for _, resolve := range thumbnailResolvers {
+		if src := resolve(item); src != "" {
+			return src
+		}
+	}
+	return ""
+}
+
+// Grab the youtube thumbnail if it is in the images list.
+func youtubeThumbnail(item ResultItem) string {
+	for k, v := range item.Images {
+		// Some responses have images without a src, or with one that isn't a string.
+		source, ok := v["src"].(string)
+		if !ok || source == "" {
+			slog.Debug("Skipping image without a src", "id", item.ItemID, "image", k)
+			continue
+		}
+
+		if strings.Contains(source, "i.ytimg.com") || strings.Contains(source, "img.youtube.com") {
+			return source
+		}
+	}
+	return ""
+}
+
+// Ask Vimeo's oEmbed endpoint for the thumbnail of a Vimeo video.
+func vimeoThumbnail(item ResultItem) string {
+	u, err := url.Parse(item.ResolvedURL)
+	if err != nil || !isWebURL(item.ResolvedURL) || (u.Hostname() != "vimeo.com" && !strings.HasSuffix(u.Hostname(), ".vimeo.com")) {
+		return ""
+	}
+
+	// Asking counts towards -concurrency, like downloading an image does.
+	defer acquireSlot()()
+	resp, err := getRemote("https://vimeo.com/api/oembed.json?url="+url.QueryEscape(item.ResolvedURL), nil)
+	if err != nil {
+		slog.Warn("Vimeo request failed", "id", item.ItemID, "url", item.ResolvedURL, "error", err)
+		return ""
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return ""
+	}
+
+	var embed struct {
+		ThumbnailURL string `json:"thumbnail_url"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxPageSize)).Decode(&embed); err != nil {
+		return ""
+	}
+	return embed.ThumbnailURL
+}
+
+// Fetch the page and use its Open Graph image, or its Twitter/X card image
+// if it doesn't have one. This is most pages, and far cheaper than Chrome.
+func metaThumbnail(item ResultItem) string {
+	// Only web pages have anything for us to fetch.
+	if !isWebURL(item.ResolvedURL) {
+		return ""
+	}
+
+	defer acquireSlot()()
+	resp, err := getRemote(item.ResolvedURL, nil)
+	if err != nil {
+		slog.Warn("Page request failed", "id", item.ItemID, "url", item.ResolvedURL, "error", err)
+		return ""
+	}
+	defer resp.Body.Close()
+
+	// Only html pages have meta tags, so don't bother reading anything else.
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if resp.StatusCode != 200 || mediaType != "text/html" {
+		return ""
+	}
+
+	tags := metaTags(io.LimitReader(resp.Body, maxPageSize))
+	src := firstNonEmpty(tags["og:image:secure_url"], tags["og:image"], tags["twitter:image"], tags["twitter:image:src"])
+	if src == "" {
+		return ""
+	}
+
+	// Image urls can be relative to the page they're on.
+	ref, err := url.Parse(src)
+	if err != nil {
+		return ""
+	}
+	return resp.Request.URL.ResolveReference(ref).String()
+}
+
+// Collect the content of a page's <meta> tags, keyed by their property or name.
+// We stop at the <body>, since that's as far as the tags should go.
+func metaTags(r io.Reader) map[string]string {
+	tags := map[string]string{}
+	z := html.NewTokenizer(r)
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return tags
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "body":
+				return tags
+			case "meta":
+				var key, content string
+				for hasAttr {
+					var k, v []byte
+					k, v, hasAttr = z.TagAttr()
+					switch string(k) {
+					case "property", "name":
+						key = strings.ToLower(string(v))
+					case "content":
+						content = strings.TrimSpace(string(v))
+					}
+				}
+
+				// Keep the first of each tag, pages can list several images.
+				if _, ok := tags[key]; key != "" && !ok {
+					tags[key] = content
+				}
+			}
+		}
+	}
+}
+
+// Use the largest of the images Pocket found in the item, going by the
+// dimensions it gives for them. Images without dimensions are skipped, as
+// they're as likely to be an icon as anything.
+func largestImage(item ResultItem) string {
+	// Go through the images in order, so the first of any the same size wins.
+	keys := make([]string, 0, len(item.Images))
+	for k := range item.Images {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	best, bestArea := "", 0
+	for _, k := range keys {
+		image := item.Images[k]
+		src, _ := image["src"].(string)
+		area := imageDimension(image["width"]) * imageDimension(image["height"])
+		if src != "" && area > bestArea {
+			best, bestArea = src, area
+		}
+	}
+	return best
+}
+
+// Parse one of an image's dimensions, which Pocket sends as a string but
+// could be a number. Anything we can't parse counts as 0.
+func imageDimension(v interface{}) int {
+	switch v := v.(type) {
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 0 {
+			return 0
+		}
+		return n
+	case float64:
+		if v < 0 {
+			return 0
+		}
+		return int(v)
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+func TestResolveThumbnailMalformedImages(t *testing.T) {
+	tests := []struct {
+		name   string
+		images map[string]map[string]interface{}
+		want   string
+	}{
+		{
+			name:   "missing src",
+			images: map[string]map[string]interface{}{"1": {"width": "640", "height": "480"}},
+			want:   "",
+		},
+		{
+			name:   "non-string src",
+			images: map[string]map[string]interface{}{"1": {"src": 42.0, "width": "640", "height": "480"}},
+			want:   "",
+		},
+		{
+			name:   "nil src",
+			images: map[string]map[string]interface{}{"1": {"src": nil}},
+			want:   "",
+		},
+		{
+			name:   "nil image",
+			images: map[string]map[string]interface{}{"1": nil},
+			want:   "",
+		},
+		{
+			name: "malformed images alongside a good one",
+			images: map[string]map[string]interface{}{
+				"1": {"src": nil, "width": "2000", "height": "2000"},
+				"2": {"src": []interface{}{"https://example.com/a.jpg"}},
+				"3": {"src": "https://example.com/b.jpg", "width": "not a number", "height": nil},
+				"4": {"src": "https://example.com/c.jpg", "width": 640.0, "height": "480"},
+			},
+			want: "https://example.com/c.jpg",
+		},
+		{
+			name: "youtube thumbnail among malformed images",
+			images: map[string]map[string]interface{}{
+				"1": {"src": true},
+				"2": {"src": "https://i.ytimg.com/vi/abc/hqdefault.jpg"},
+			},
+			want: "https://i.ytimg.com/vi/abc/hqdefault.jpg",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Without a url, only the resolvers that look at images have anything to go on.
+			item := ResultItem{ItemID: 1, Images: tt.images}
+			if got := resolveThumbnail(item); got != tt.want {
+				t.Errorf("resolveThumbnail() = %q, want %q", got, tt.want)
+			}
+			if got := youtubeThumbnail(item); tt.want == "" && got != "" {
+				t.Errorf("youtubeThumbnail() = %q, want %q", got, "")
+			}
+			if got := largestImage(item); tt.want == "" && got != "" {
+				t.Errorf("largestImage() = %q, want %q", got, "")
+			}
+		})
+	}
+}
+
+func TestResolversSkipNonWebURLs(t *testing.T) {
+	// Fetching any of these would block on our unset work slots, so returning
+	// at all means we didn't try.
+	for _, u := range []string{"mailto:someone@example.com", "file:///etc/passwd", "vimeo.com/123", ""} {
+		item := ResultItem{ItemID: 1, ResolvedURL: u}
+		if got := metaThumbnail(item); got != "" {
+			t.Errorf("metaThumbnail(%q) = %q, want %q", u, got, "")
+		}
+		if got := vimeoThumbnail(item); got != "" {
+			t.Errorf("vimeoThumbnail(%q) = %q, want %q", u, got, "")
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Where we keep what we need to ask whether the remote images we've saved
+// have changed, keyed by their image's filename.
+var validatorsFile = filepath.Join(cacheDir, "validators.json")
+
+// Where a remote image came from, and the validators its server gave us for it.
+type imageValidator struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// Build the headers for a conditional request, so the server can tell us the
+// image hasn't changed rather than sending it again.
+func (v imageValidator) header() http.Header {
+	header := http.Header{}
+	if v.ETag != "" {
+		header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		header.Set("If-Modified-Since", v.LastModified)
+	}
+	return header
+}
+
+// Our validators, read the first time we need them and written back once
+// we've processed our items, if they've changed.
+var validators struct {
+	once    sync.Once
+	mu      sync.Mutex
+	byFile  map[string]imageValidator
+	changed bool
+}
+
+// Read our validators in, if we haven't already.
+func loadValidators() {
+	validators.once.Do(func() {
+		validators.byFile = map[string]imageValidator{}
+
+		data, err := ioutil.ReadFile(outputPath(validatorsFile))
+		if os.IsNotExist(err) {
+			return
+		} else if err != nil {
+			slog.Warn("Could not read image validators", "error", err)
+			return
+		}
+		if err := json.Unmarshal(data, &validators.byFile); err != nil {
+			slog.Warn("Could not decode image validators", "file", validatorsFile, "error", err)
+		}
+	})
+}
+
+// Remember where an image we've just saved came from, and its validators. If
+// the server didn't give us any, there's nothing to check later, so we forget it.
+func rememberValidator(filename, src string, header http.Header) {
+	loadValidators()
+	validators.mu.Lock()
+	defer validators.mu.Unlock()
+
+	name := filepath.Base(filename)
+	v := imageValidator{URL: src, ETag: header.Get("ETag"), LastModified: header.Get("Last-Modified")}
+	if v.ETag == "" && v.LastModified == "" {
+		if _, ok := validators.byFile[name]; ok {
+			delete(validators.byFile, name)
+			validators.changed = true
+		}
+		return
+	}
+
+	validators.byFile[name] = v
+	validators.changed = true
+}
+
+// Check whether a remote image we've saved has changed at its source, and
+// download it again if it has. Returns whether it was downloaded again.
+// Screenshots, and images without validators, are left as they are.
+func revalidateImage(filename string) bool {
+	loadValidators()
+	validators.mu.Lock()
+	v, ok := validators.byFile[filepath.Base(filename)]
+	validators.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	saved, _ := downloadImage(v.URL, filename, v)
+	if saved {
+		slog.Info("Refreshed changed image", "file", filename, "url", v.URL)
+	}
+	return saved
+}
+
+// Write our validators back out, if they've changed.
+func saveValidators() error {
+	validators.mu.Lock()
+	defer validators.mu.Unlock()
+	if !validators.changed {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(validators.byFile, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(outputPath(validatorsFile), data); err != nil {
+		return err
+	}
+	validators.changed = false
+	return nil
+}
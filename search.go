@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// How much a search term matching each part of an item counts towards its
+// score, so items about a term rank above ones that just mention it.
+const (
+	titleWeight   = 3
+	tagWeight     = 2
+	excerptWeight = 1
+)
+
+// An item that matched a search, and how well it matched.
+type searchResult struct {
+	Item
+	Score int `json:"score"`
+}
+
+// Split text into lowercase words, dropping punctuation.
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Count how many words start with a term, so a search for "go" finds "golang" too.
+func countMatches(words []string, term string) int {
+	n := 0
+	for _, word := range words {
+		if strings.HasPrefix(word, term) {
+			n++
+		}
+	}
+	return n
+}
+
+// Score an item against the terms of a search. Every term has to match
+// somewhere, otherwise the item doesn't match at all and scores 0.
+func scoreItem(item Item, terms []string) int {
+	title := tokenize(item.Title)
+	excerpt := tokenize(item.Excerpt)
+	tags := tokenize(strings.Join(item.Tags, " "))
+
+	score := 0
+	for _, term := range terms {
+		termScore := countMatches(title, term)*titleWeight +
+			countMatches(tags, term)*tagWeight +
+			countMatches(excerpt, term)*excerptWeight
+		if termScore == 0 {
+			return 0
+		}
+		score += termScore
+	}
+	return score
+}
+
+// Rank items by how well they match a search, best first, leaving out any
+// that don't match every term. Items that score the same keep their order.
+func searchItems(items []Item, terms []string) []searchResult {
+	results := []searchResult{}
+	for _, item := range items {
+		if score := scoreItem(item, terms); score > 0 {
+			results = append(results, searchResult{Item: item, Score: score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
+
+// Handle the search url, which ranks our cached items against the words in
+// q. It can also be filtered with type, tag, and favorite, like /api/items.
+func handleSearch(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	terms := tokenize(query.Get("q"))
+	if len(terms) == 0 {
+		http.Error(w, "Missing search query, like ?q=go+concurrency", http.StatusBadRequest)
+		return
+	}
+
+	items, err := readCachedItems(siteFrom(req.Context()).profile)
+	if err != nil {
+		slog.Error("Failed reading cache", "error", err)
+		http.Error(w, "Failed reading cache", http.StatusInternalServerError)
+		return
+	}
+
+	// Our terms do the searching, rather than matching q as a whole.
+	query.Del("q")
+	results := searchItems(filterItems(items, query), terms)
+
+	output, err := json.Marshal(results)
+	if err != nil {
+		slog.Error("Failed marshaling JSON", "error", err)
+		http.Error(w, "Failed marshaling JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(output)
+}
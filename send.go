@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const sendUrl = host + "/send"
+
+// A single change to make to an item, as the send endpoint expects it.
+type sendAction struct {
+	Action string `json:"action"`
+	ItemID string `json:"item_id"`
+}
+
+// Send a batch of actions to Pocket in a single request, returning whether
+// each one worked, in the same order.
+func sendActions(actions []sendAction) ([]bool, error) {
+	var resp struct {
+		Status        int               `json:"status"`
+		ActionResults []json.RawMessage `json:"action_results"`
+	}
+	err := postPocket(sendUrl, map[string]interface{}{
+		"consumer_key": key,
+		"access_token": token,
+		"actions":      actions,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each result is false if the action failed, and true (or some details) if it worked.
+	results := make([]bool, len(actions))
+	for i := range results {
+		if i < len(resp.ActionResults) {
+			result := string(resp.ActionResults[i])
+			results[i] = result != "false" && result != "null"
+		}
+	}
+	return results, nil
+}
+
+// Parse the item IDs we've been given on the command line.
+func parseItemIDs(args []string) ([]int, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no item IDs given")
+	}
+
+	ids := make([]int, len(args))
+	for i, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid item ID %q", arg)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// Apply the same action to each of the given items in a single batch, reporting
+// how it went for each of them. Returns the IDs of the items it worked for.
+func sendItemActions(action string, args []string) []int {
+	if err := checkCredentials(true); err != nil {
+		exitWithHelp(err)
+	}
+
+	ids, err := parseItemIDs(args)
+	if err != nil {
+		fatal(err.Error())
+	}
+
+	actions := make([]sendAction, len(ids))
+	for i, id := range ids {
+		actions[i] = sendAction{Action: action, ItemID: strconv.Itoa(id)}
+	}
+
+	results, err := sendActions(actions)
+	if err != nil {
+		fatal("Failed sending actions", "action", action, "error", err)
+	}
+
+	var done []int
+	for i, id := range ids {
+		if results[i] {
+			fmt.Printf("%s %d: ok\n", action, id)
+			done = append(done, id)
+		} else {
+			fmt.Printf("%s %d: failed\n", action, id)
+		}
+	}
+	slog.Debug("Sent actions", "action", action, "sent", len(ids), "succeeded", len(done))
+	return done
+}
+
+// Archive items, marking them as read.
+func archive(args []string) {
+	if done := sendItemActions("archive", args); len(done) < len(args) {
+		os.Exit(1)
+	}
+}
+
+// Favorite, or unfavorite, items, updating our cached copies to match.
+func favoriteItems(action string, favorite bool) func(args []string) {
+	return func(args []string) {
+		done := map[int]bool{}
+		for _, id := range sendItemActions(action, args) {
+			done[id] = true
+		}
+
+		err := updateCachedItems(func(items []Item) []Item {
+			for i := range items {
+				if done[items[i].ID] {
+					items[i].Favorite = favorite
+				}
+			}
+			return items
+		})
+		if err != nil {
+			fatal("Failed updating cache file", "error", err)
+		}
+
+		if len(done) < len(args) {
+			os.Exit(1)
+		}
+	}
+}
+
+// Delete items from Pocket, along with their images and cached copies.
+func deleteItems(args []string) {
+	done := sendItemActions("delete", args)
+
+	deleted := map[int]bool{}
+	for _, id := range done {
+		deleted[id] = true
+		removeItemImages(id)
+	}
+
+	err := updateCachedItems(func(items []Item) []Item {
+		kept := []Item{}
+		for _, item := range items {
+			if !deleted[item.ID] {
+				kept = append(kept, item)
+			}
+		}
+		return kept
+	})
+	if err != nil {
+		fatal("Failed updating cache file", "error", err)
+	}
+
+	if len(done) < len(args) {
+		os.Exit(1)
+	}
+}
+
+// Remove the images and PDF saved for an item under its ID. Images shared by url
+// with -dedupe may still be used by other items, so those are left for prune.
+func removeItemImages(id int) {
+	files, _ := filepath.Glob(filepath.Join(outputPath(imagesDir), strconv.Itoa(id)+".*"))
+	files = append(files, filepath.Join(outputPath(imagesDir), strconv.Itoa(id)+"_thumb.png"))
+	files = append(files, filepath.Join(outputPath(pdfDir), strconv.Itoa(id)+".pdf"))
+
+	for _, filename := range files {
+		if err := os.Remove(filename); err == nil {
+			slog.Info("Deleted image", "file", filename)
+		} else if !os.IsNotExist(err) {
+			slog.Error("Could not delete image", "file", filename, "error", err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+)
+
+// Names a profile can't have, since the server mounts every profile at its
+// name and these are already taken by our own urls.
+var reservedProfiles = []string{"api", "images", "pdf", "metrics", "healthz"}
+
+// What the server serves for one profile: its cache and images, and its live
+// items from its own Pocket account.
+type site struct {
+	profile    string
+	key, token string
+	live       *itemsCache
+}
+
+type siteKey struct{}
+
+// Mark a request or fetch as being for a site.
+func withSite(ctx context.Context, s *site) context.Context {
+	return context.WithValue(ctx, siteKey{}, s)
+}
+
+// Get the site a request or fetch is for, which is the profile we were run
+// with unless it's for one of the other profiles the server mounts.
+func siteFrom(ctx context.Context) *site {
+	if s, ok := ctx.Value(siteKey{}).(*site); ok {
+		return s
+	}
+	return &site{profile: opts.Profile, key: key, token: token, live: liveItems}
+}
+
+// Register the urls every site has: its live and cached items, its feed, and
+// its files.
+func siteRoutes(mux *http.ServeMux, profile string) {
+	mux.HandleFunc("/api/items", handleItems)
+	mux.HandleFunc("GET /api/item/{id}", handleItem)
+	mux.HandleFunc("GET /api/search", handleSearch)
+	mux.HandleFunc("/feed.xml", handleFeed)
+	mux.Handle("/", http.FileServer(http.Dir(profilePath(profile, cacheDir))))
+
+	// Without a JSON file to serve our cached list from, get it from the database.
+	if opts.Store == "sqlite" {
+		mux.HandleFunc("GET /all.json", handleDBItems)
+	}
+
+	// The screenshots folder will serve our static folder of images.
+	images := profilePath(profile, imagesDir)
+	mux.Handle("/images/", http.StripPrefix("/images/", withCaching(images, http.FileServer(http.Dir(images)))))
+}
+
+// Mount every profile in our config file under its name, like /work/api/items,
+// so one server can serve all our accounts. Their live items are fetched in
+// the given context, which is cancelled when we shut down.
+func mountProfiles(ctx context.Context) {
+	c, err := loadConfig()
+	if err != nil {
+		slog.Warn("Could not read profiles from config file", "error", err)
+		return
+	}
+
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !validProfile.MatchString(name) || contains(reservedProfiles, name) {
+			slog.Warn("Not serving profile with a name we can't mount", "profile", name)
+			continue
+		}
+
+		p := c.Profiles[name]
+		s := &site{
+			profile: name,
+			key:     firstNonEmpty(p.ConsumerKey, c.ConsumerKey, os.Getenv("POCKET_CONSUMER_KEY"), opts.ConsumerKey),
+			token:   p.AccessToken,
+		}
+		s.live = &itemsCache{ctx: withSite(ctx, s)}
+
+		mux := http.NewServeMux()
+		siteRoutes(mux, name)
+		http.Handle("/"+name+"/", http.StripPrefix("/"+name, s.handler(mux)))
+		slog.Debug("Serving profile", "profile", name, "path", "/"+name+"/")
+	}
+}
+
+// Serve requests for a site, so its handlers use its cache and account.
+func (s *site) handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h.ServeHTTP(w, req.WithContext(withSite(req.Context(), s)))
+	})
+}
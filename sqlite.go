@@ -0,0 +1,214 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	_ "modernc.org/sqlite"
+)
+
+// Where we keep our items when they're stored in SQLite.
+var dbFile = filepath.Join(cacheDir, "items.db")
+
+// Ways we can store our cached items.
+var validStores = []string{"json", "sqlite"}
+
+// Each item is kept whole as JSON, alongside the columns we filter by and its
+// position in our sorted list.
+const schema = `
+CREATE TABLE IF NOT EXISTS items (
+	item_id  INTEGER PRIMARY KEY,
+	position INTEGER NOT NULL,
+	type     TEXT NOT NULL,
+	favorite INTEGER NOT NULL,
+	title    TEXT NOT NULL,
+	excerpt  TEXT NOT NULL,
+	tags     TEXT NOT NULL,
+	data     TEXT NOT NULL
+)`
+
+// Our databases, one for each profile, opened the first time we need them
+// and shared after that.
+var dbs struct {
+	sync.Mutex
+	byProfile map[string]*sql.DB
+}
+
+// Open a profile's database, creating it and its table if they don't exist yet.
+func openDB(profile string) (*sql.DB, error) {
+	dbs.Lock()
+	defer dbs.Unlock()
+	if db, ok := dbs.byProfile[profile]; ok {
+		return db, nil
+	}
+
+	db, err := sql.Open("sqlite", "file:"+profilePath(profile, dbFile)+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating items table: %w", err)
+	}
+
+	if dbs.byProfile == nil {
+		dbs.byProfile = map[string]*sql.DB{}
+	}
+	dbs.byProfile[profile] = db
+	return db, nil
+}
+
+// Upsert our items into the database, and remove any that aren't in the list
+// anymore, all in one transaction so readers never see half of it.
+func writeDBItems(items []Item) error {
+	db, err := openDB(opts.Profile)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`CREATE TEMP TABLE IF NOT EXISTS current (item_id INTEGER PRIMARY KEY); DELETE FROM current`); err != nil {
+		return err
+	}
+
+	for i, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		tags, err := json.Marshal(item.Tags)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO items (item_id, position, type, favorite, title, excerpt, tags, data)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (item_id) DO UPDATE SET
+				position = excluded.position, type = excluded.type, favorite = excluded.favorite,
+				title = excluded.title, excerpt = excluded.excerpt, tags = excluded.tags, data = excluded.data`,
+			item.ID, i, item.Type, item.Favorite, item.Title, item.Excerpt, string(tags), string(data))
+		if err != nil {
+			return fmt.Errorf("saving item %d: %w", item.ID, err)
+		}
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO current (item_id) VALUES (?)`, item.ID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM items WHERE item_id NOT IN (SELECT item_id FROM current)`); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Read all of a profile's items from its database, in order.
+func readDBItems(profile string) ([]Item, error) {
+	items, _, err := queryDBItems(profile, url.Values{})
+	return items, err
+}
+
+// Read a single item from a profile's database, returning false if it isn't there.
+func readDBItem(profile string, id int) (Item, bool, error) {
+	db, err := openDB(profile)
+	if err != nil {
+		return Item{}, false, err
+	}
+
+	var data string
+	err = db.QueryRow(`SELECT data FROM items WHERE item_id = ?`, id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return Item{}, false, nil
+	} else if err != nil {
+		return Item{}, false, err
+	}
+
+	var item Item
+	if err := json.Unmarshal([]byte(data), &item); err != nil {
+		return Item{}, false, err
+	}
+	return item, true, nil
+}
+
+// Query a profile's items from its database with the same filters and paging
+// as filterItems and paginateItems, but done by SQLite. Returns the page of
+// items along with how many items matched in total.
+func queryDBItems(profile string, query url.Values) ([]Item, int, error) {
+	db, err := openDB(profile)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	if itemType := query.Get("type"); itemType != "" {
+		where = append(where, `lower(type) = lower(?)`)
+		args = append(args, itemType)
+	}
+	if tag := query.Get("tag"); tag != "" {
+		where = append(where, `EXISTS (SELECT 1 FROM json_each(items.tags) WHERE json_each.value = ?)`)
+		args = append(args, tag)
+	}
+	if favorite, err := strconv.ParseBool(query.Get("favorite")); err == nil {
+		where = append(where, `favorite = ?`)
+		args = append(args, favorite)
+	}
+	if search := strings.ToLower(query.Get("q")); search != "" {
+		where = append(where, `(instr(lower(title), ?) > 0 OR instr(lower(excerpt), ?) > 0)`)
+		args = append(args, search, search)
+	}
+
+	conditions := ""
+	if len(where) > 0 {
+		conditions = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM items`+conditions, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// SQLite takes a negative limit as no limit at all.
+	limit, offset, err := pageBounds(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	if limit == 0 {
+		limit = -1
+	}
+
+	rows, err := db.Query(`SELECT data FROM items`+conditions+` ORDER BY position LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	items := []Item{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, 0, err
+		}
+
+		var item Item
+		if err := json.Unmarshal([]byte(data), &item); err != nil {
+			return nil, 0, err
+		}
+		items = append(items, item)
+	}
+	return items, total, rows.Err()
+}
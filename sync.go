@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Where we keep our cached items and images.
+const (
+	cacheDir  = "cache"
+	imagesDir = "images"
+)
+
+// Our cache files, relative to our output directory.
+var (
+	cacheFile = filepath.Join(cacheDir, "all.json")
+	stateFile = filepath.Join(cacheDir, "state.json")
+
+	// Where we used to keep just the time of our last sync, before the state file.
+	legacySinceFile = filepath.Join(cacheDir, "since")
+)
+
+// Resolve one of our cache or image paths against our output directory, for
+// the profile we're run with.
+func outputPath(name string) string {
+	return profilePath(opts.Profile, name)
+}
+
+// Resolve one of our cache or image paths for a profile. Each profile has a
+// subdirectory in each of our directories, like cache/work/all.json, so
+// profiles never share files.
+func profilePath(profile, name string) string {
+	if profile == "" {
+		return filepath.Join(opts.OutputDir, name)
+	}
+
+	dir, rest, _ := strings.Cut(filepath.ToSlash(name), "/")
+	return filepath.Join(opts.OutputDir, dir, profile, filepath.FromSlash(rest))
+}
+
+// What we remember between syncs.
+type syncState struct {
+	// The time Pocket gave us for our last sync, to get changes since.
+	Since int `json:"since"`
+
+	// When we last synced, and how many items we had after.
+	LastRun   time.Time `json:"last_run"`
+	ItemCount int       `json:"item_count"`
+}
+
+// Pocket's statuses for an item that's unread, archived, or deleted.
+const (
+	statusUnread   = 0
+	statusArchived = 1
+	statusDeleted  = 2
+)
+
+// Whether an item with a status is in the state we retrieve with -state.
+func inState(status int, state string) bool {
+	switch state {
+	case "unread":
+		return status == statusUnread
+	case "archive":
+		return status == statusArchived
+	}
+	return status != statusDeleted
+}
+
+// How long after an item was added we keep syncing it again while Pocket
+// hasn't resolved it. It usually takes minutes, and some never resolve.
+const unresolvedRetryWindow = 24 * time.Hour
+
+// Check whether Pocket has finished resolving an item, which gives it a
+// resolved id along with its title, url, and word count.
+func isUnresolved(item ResultItem) bool {
+	return item.ResolvedID == 0
+}
+
+// Work out when to sync from next time so we get any recently added items
+// Pocket hasn't resolved yet again, since resolving them doesn't always
+// count as a change. Returns since if there aren't any.
+func retrySince(results Result, since int) int {
+	cutoff := time.Now().Add(-unresolvedRetryWindow).Unix()
+	for _, item := range results.List {
+		if item.Status == statusDeleted || !isUnresolved(item) || item.TimeAdded < cutoff {
+			continue
+		}
+		if item.TimeAdded <= int64(since) {
+			since = int(item.TimeAdded) - 1
+		}
+	}
+	return since
+}
+
+// Get only the items that have changed since our last sync, and merge them
+// into our cached items. Returns the merged items, and the time of this sync
+// to save once they've been written.
+func syncItems(ctx context.Context) ([]Item, int, error) {
+	state, err := loadState()
+	if err != nil {
+		return nil, 0, err
+	}
+	since := state.Since
+
+	// Get changes to items in any state, so we hear about ones that have left
+	// our -state too, like unread items we've since archived.
+	retrieveState := opts.State
+	if since > 0 {
+		retrieveState = "all"
+	}
+	results, err := retrievePocketItems(ctx, since, retrieveState)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Leave those out of the changes, and drop them from our cache below.
+	left := map[int]bool{}
+	for id, item := range results.List {
+		if item.Status != statusDeleted && !inState(item.Status, opts.State) {
+			left[item.ItemID] = true
+			delete(results.List, id)
+		}
+	}
+
+	fresh, err := processItems(ctx, results, true)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Sync from before any items that are still unresolved next time.
+	next := retrySince(results, results.Since)
+
+	// Without a previous sync we got everything, so there's nothing to merge.
+	if since == 0 {
+		return fresh, next, nil
+	}
+
+	cached, err := readCachedItems(opts.Profile)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Pocket sends back deleted items with a status of 2, so drop those.
+	deleted := map[int]bool{}
+	for _, item := range results.List {
+		if item.Status == statusDeleted {
+			deleted[item.ItemID] = true
+		}
+	}
+
+	cached = dropItems(cached, func(id int) bool { return left[id] })
+	items := mergeItems(cached, fresh, deleted)
+
+	// The changes we get don't include items that have left our list by losing
+	// a tag or favorite, or no longer matching a search, so check which are
+	// still in it.
+	if opts.Tag != "" || opts.FavoritesOnly || opts.Search != "" {
+		if items, err = reconcileItems(ctx, items); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return items, next, nil
+}
+
+// Drop any of our items that aren't in our list in Pocket anymore, along with
+// their images, so the cache doesn't keep items we've archived or untagged.
+func reconcileItems(ctx context.Context, items []Item) ([]Item, error) {
+	results, err := retrievePocketItems(ctx, 0, opts.State)
+	if err != nil {
+		return nil, err
+	}
+
+	current := map[int]bool{}
+	for _, result := range results.List {
+		if result.Status != statusDeleted {
+			current[result.ItemID] = true
+		}
+	}
+	return dropItems(items, func(id int) bool { return !current[id] }), nil
+}
+
+// Drop the items that have left our list, along with their images.
+func dropItems(items []Item, gone func(id int) bool) []Item {
+	kept := []Item{}
+	for _, item := range items {
+		if !gone(item.ID) {
+			kept = append(kept, item)
+			continue
+		}
+
+		if opts.DryRun {
+			fmt.Printf("item %d: would drop it and its images, since it's no longer in the list\n", item.ID)
+			continue
+		}
+		slog.Info("Dropping item no longer in list", "id", item.ID, "title", item.Title)
+		removeItemImages(item.ID)
+	}
+	return kept
+}
+
+// Merge freshly retrieved items into our cached ones. Fresh items come first
+// and replace any cached copy, and deleted items are dropped.
+func mergeItems(cached, fresh []Item, deleted map[int]bool) []Item {
+	seen := map[int]bool{}
+	items := []Item{}
+
+	for _, item := range fresh {
+		seen[item.ID] = true
+		items = append(items, item)
+	}
+	for _, item := range cached {
+		if !seen[item.ID] && !deleted[item.ID] {
+			items = append(items, item)
+		}
+	}
+
+	// Sort IDs from different syncs don't line up, so number them again.
+	for i := range items {
+		items[i].SortID = i
+	}
+	sortItems(items)
+
+	return items
+}
+
+// The version of our cache file's format. Bump it whenever the shape of Item
+// changes, so anyone reading the file can tell. The bare array we used to
+// write, which -legacy-array still does, counts as version 1.
+const cacheVersion = 2
+
+// Our cached items as we write them out, along with what they need to make
+// sense of them.
+type cachedItems struct {
+	Version     int       `json:"version"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Count       int       `json:"count"`
+	Items       []Item    `json:"items"`
+}
+
+// Wrap our items up to be written out, unless -legacy-array wants them bare.
+func newCachedItems(items []Item, generatedAt time.Time) interface{} {
+	if opts.LegacyArray {
+		return items
+	}
+	return cachedItems{
+		Version:     cacheVersion,
+		GeneratedAt: generatedAt,
+		Count:       len(items),
+		Items:       items,
+	}
+}
+
+// Read the items we last wrote to a profile's cache, which is empty if there isn't one.
+func readCachedItems(profile string) ([]Item, error) {
+	if opts.Store == "sqlite" {
+		return readDBItems(profile)
+	}
+
+	items := []Item{}
+
+	data, err := ioutil.ReadFile(profilePath(profile, cacheFile))
+	if os.IsNotExist(err) {
+		return items, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Caches written before we had versions, or with -legacy-array, are a bare array.
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+
+	var cached cachedItems
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, err
+	}
+	if cached.Version > cacheVersion {
+		return nil, fmt.Errorf("cache file is version %d, newer than the version %d we understand", cached.Version, cacheVersion)
+	}
+	if cached.Items != nil {
+		items = cached.Items
+	}
+	return items, nil
+}
+
+// Read a single item from a profile's cache by its ID, returning false if it isn't there.
+func readCachedItem(profile string, id int) (Item, bool, error) {
+	if opts.Store == "sqlite" {
+		return readDBItem(profile, id)
+	}
+
+	items, err := readCachedItems(profile)
+	if err != nil {
+		return Item{}, false, err
+	}
+	for _, item := range items {
+		if item.ID == id {
+			return item, true, nil
+		}
+	}
+	return Item{}, false, nil
+}
+
+// Write our items to the cache, swapping the whole file in at once so it's
+// never served half written.
+func writeCachedItems(items []Item) error {
+	if opts.Store == "sqlite" {
+		return writeDBItems(items)
+	}
+
+	data, err := json.MarshalIndent(newCachedItems(items, time.Now()), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(outputPath(cacheFile), data)
+}
+
+// Change our cached items in place, so the served list reflects a change without
+// retrieving everything again. If there's no cache yet, there's nothing to change.
+func updateCachedItems(update func(items []Item) []Item) error {
+	if (opts.Store == "sqlite" && !fileExists(outputPath(dbFile))) || (opts.Store == "json" && !fileExists(outputPath(cacheFile))) {
+		return nil
+	}
+
+	items, err := readCachedItems(opts.Profile)
+	if err != nil {
+		return err
+	}
+	return writeCachedItems(update(items))
+}
+
+// Load our state from our last sync, which is empty if we haven't synced before.
+func loadState() (syncState, error) {
+	var state syncState
+
+	data, err := ioutil.ReadFile(opts.SinceFile)
+	if os.IsNotExist(err) {
+		return loadLegacySince()
+	} else if err != nil {
+		return state, err
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("decoding %s: %w", opts.SinceFile, err)
+	}
+	return state, nil
+}
+
+// Load the time of our last sync from before we had a state file, so
+// upgrading doesn't mean starting over.
+func loadLegacySince() (syncState, error) {
+	data, err := ioutil.ReadFile(outputPath(legacySinceFile))
+	if os.IsNotExist(err) {
+		return syncState{}, nil
+	} else if err != nil {
+		return syncState{}, err
+	}
+
+	since, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	return syncState{Since: since}, err
+}
+
+// Save our state for the next sync.
+func saveState(state syncState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(opts.SinceFile, data)
+}
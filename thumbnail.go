@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"log/slog"
+	"os"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// The widest a thumbnail can be, anything wider gets scaled down to fit.
+const maxThumbnailWidth = 480
+
+// Save a downscaled PNG copy of a saved image, keeping its aspect ratio.
+func saveThumbnail(src, filename string) bool {
+	slog.Debug("Saving thumbnail", "file", filename, "src", src)
+
+	// Open and decode our full size image.
+	file, err := os.Open(src)
+	if err != nil {
+		slog.Warn("Could not open image", "file", src, "error", err)
+		return false
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		slog.Warn("Could not decode image", "file", src, "error", err)
+		return false
+	}
+
+	// Scale the image down if it's too wide, otherwise keep it as-is.
+	thumb := img
+	bounds := img.Bounds()
+	if bounds.Dx() > maxThumbnailWidth {
+		height := bounds.Dy() * maxThumbnailWidth / bounds.Dx()
+		scaled := image.NewRGBA(image.Rect(0, 0, maxThumbnailWidth, height))
+		draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Over, nil)
+		thumb = scaled
+	}
+
+	// Encode our thumbnail, then write it to the local filesystem in one go,
+	// so it's never served half written.
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, thumb); err != nil {
+		slog.Error("Could not encode thumbnail", "file", filename, "error", err)
+		return false
+	}
+	if err := writeFileAtomic(filename, buf.Bytes()); err != nil {
+		slog.Error("Could not write thumbnail", "file", filename, "error", err)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Running totals of the slow work we do, for -verbose to summarize.
+var stats struct {
+	screenshots    atomic.Int64
+	screenshotTime atomic.Int64
+	downloads      atomic.Int64
+}
+
+// A copy of our totals at one point, to compare with later.
+type statsSnapshot struct {
+	screenshots    int64
+	screenshotTime time.Duration
+	downloads      int64
+}
+
+// Take a copy of our totals so far.
+func snapshotStats() statsSnapshot {
+	return statsSnapshot{
+		screenshots:    stats.screenshots.Load(),
+		screenshotTime: time.Duration(stats.screenshotTime.Load()),
+		downloads:      stats.downloads.Load(),
+	}
+}
+
+// Log a summary of the work done since an earlier snapshot, with -verbose.
+func logStatsSince(before statsSnapshot, items, unresolved int, start time.Time) {
+	after := snapshotStats()
+	shots := after.screenshots - before.screenshots
+
+	var average time.Duration
+	if shots > 0 {
+		average = (after.screenshotTime - before.screenshotTime) / time.Duration(shots)
+	}
+
+	logVerbose("Processed items",
+		"items", items,
+		"unresolved", unresolved,
+		"screenshots", shots,
+		"downloads", after.downloads-before.downloads,
+		"duration", time.Since(start).Round(time.Millisecond),
+		"average_screenshot", average.Round(time.Millisecond))
+}
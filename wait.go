@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// The longest we'll wait for a page's network to go idle before taking its
+// screenshot anyway, since pages that keep polling never do.
+const networkIdleTimeout = 10 * time.Second
+
+// Ways we can wait for a page to be ready after it loads: not at all, until
+// its network has been idle for a moment, or until its body is visible.
+var validWaits = []string{"load", "networkidle", "visible"}
+
+// Navigate to a page and wait for it to be ready for its screenshot, the way
+// -wait asks us to, then for any -wait-delay on top.
+func navigateAndWait(url string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		var idle <-chan struct{}
+		if opts.Wait == "networkidle" {
+			var err error
+			if idle, err = watchNetworkIdle(ctx); err != nil {
+				return err
+			}
+		}
+
+		if err := chromedp.Navigate(url).Do(ctx); err != nil {
+			return err
+		}
+
+		switch opts.Wait {
+		case "networkidle":
+			select {
+			case <-idle:
+			case <-time.After(networkIdleTimeout):
+				slog.Debug("Network never went idle, taking screenshot anyway", "url", url, "waited", networkIdleTimeout)
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case "visible":
+			if err := chromedp.WaitVisible("body", chromedp.ByQuery).Do(ctx); err != nil {
+				return err
+			}
+		}
+
+		if opts.WaitDelay > 0 {
+			return chromedp.Sleep(opts.WaitDelay).Do(ctx)
+		}
+		return nil
+	})
+}
+
+// Start watching for the page we're about to navigate to going network idle,
+// returning a channel that's closed once it does. The tab's current page
+// (usually a blank one) has its own loader, so its events are ignored.
+func watchNetworkIdle(ctx context.Context) (<-chan struct{}, error) {
+	tree, err := page.GetFrameTree().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	frame := tree.Frame
+
+	idle := make(chan struct{})
+	var once sync.Once
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		if ev, ok := ev.(*page.EventLifecycleEvent); ok && ev.Name == "networkIdle" && ev.FrameID == frame.ID && ev.LoaderID != frame.LoaderID {
+			once.Do(func() { close(idle) })
+		}
+	})
+
+	if err := page.SetLifecycleEventsEnabled(true).Do(ctx); err != nil {
+		return nil, err
+	}
+	return idle, nil
+}